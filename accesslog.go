@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// statusRecorder keeps the status and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// accessLog counts the requests to the exporter by handler and status, and
+// logs them when enabled, to tell which scraper is hammering the exporter
+func accessLog(mux *http.ServeMux, logRequests bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(rec, r)
+
+		// the pattern rather than the path keeps the handler label bounded
+		_, pattern := mux.Handler(r)
+		httpRequests.WithLabelValues(pattern, strconv.Itoa(rec.status)).Inc()
+		if logRequests {
+			logrus.WithFields(logrus.Fields{
+				"remote_addr": r.RemoteAddr,
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"status":      rec.status,
+				"bytes":       rec.bytes,
+				"duration":    time.Since(start).Seconds(),
+				"user_agent":  r.UserAgent(),
+			}).Info("request")
+		}
+	})
+}
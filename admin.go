@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
+)
+
+// handleDebug registers pprof, the zombie allocations, the liveness check and
+// the effective configuration, the snapshot unless nil, and the admin API
+// when there's a token to authenticate it with
+func handleDebug(mux *http.ServeMux, e *collector.Exporter, token string, config map[string]string, snapshot http.Handler) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/zombies", e.Zombies())
+	mux.HandleFunc("/config", configFunc(config))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	if token != "" {
+		mux.Handle("/admin/collectors", adminAuth(token, collectorsFunc(e)))
+		mux.Handle("/admin/log-level", adminAuth(token, http.HandlerFunc(logLevelFunc)))
+	}
+	if snapshot != nil {
+		// it shows what the metrics aggregate away, only the admins see it
+		if token != "" {
+			snapshot = adminAuth(token, snapshot)
+		}
+		mux.Handle("/api/v1/snapshot", snapshot)
+	}
+}
+
+// adminMux serves the debug endpoints and the telemetry of the exporter
+// itself, without collecting from nomad, so it can be kept on localhost while
+// the nomad metrics are exposed to Prometheus
+func adminMux(e *collector.Exporter, token string, config map[string]string, snapshot http.Handler, collectors ...prometheus.Collector) *http.ServeMux {
+	r := prometheus.NewRegistry()
+	r.MustRegister(collector.LatencyCollectors()...)
+	r.MustRegister(collectors...)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsHandler(r))
+	handleDebug(mux, e, token, config, snapshot)
+	return mux
+}
+
+// loadAdminToken reads the bearer token the admin API requests must carry
+func loadAdminToken(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read admin token file %s: %s", path, err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("admin token file %s is empty", path)
+	}
+	return token, nil
+}
+
+func adminAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// collectorsFunc lists whether every collector runs on GET, and switches one
+// on or off on POST with name and enabled, which is true, false or default
+// to go back to what the flags say
+func collectorsFunc(e *collector.Exporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			name, value := r.FormValue("name"), r.FormValue("enabled")
+			var err error
+			if value == "default" {
+				err = e.ResetCollector(name)
+			} else {
+				var enabled bool
+				if enabled, err = strconv.ParseBool(value); err != nil {
+					err = fmt.Errorf("invalid enabled %q, expected true, false or default", value)
+				} else {
+					err = e.SetCollector(name, enabled)
+				}
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			logrus.Warnf("collector %s set to %s through the admin API", name, value)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(e.Collectors())
+	}
+}
+
+// logLevelFunc prints the log level on GET, and changes it on POST with level
+func logLevelFunc(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		level, err := logrus.ParseLevel(r.FormValue("level"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logrus.SetLevel(level)
+		logrus.Warnf("log level set to %s through the admin API", level)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fmt.Fprintln(w, logrus.GetLevel())
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// alertRulesConfig holds the knobs of the generated alerting rules
+type alertRulesConfig struct {
+	Group                     string
+	Job                       string
+	For                       string
+	NodeNotReadyFor           string
+	StaleAfter                string
+	ZombiesThreshold          int
+	BlockedEvalsThreshold     int
+	FailedDeploymentThreshold int
+}
+
+// StaleAfterSeconds is the stale threshold to compare timestamps with
+func (c alertRulesConfig) StaleAfterSeconds() float64 {
+	d, _ := model.ParseDuration(c.StaleAfter)
+	return time.Duration(d).Seconds()
+}
+
+// alertRulesTemplate uses [[ ]] delimiters so the prometheus {{ }} templates
+// in the annotations are written as they are
+var alertRulesTemplate = template.Must(template.New("rules").Delims("[[", "]]").Parse(`groups:
+- name: [[ .Group ]]
+  rules:
+  - alert: NomadExporterDown
+    expr: |
+      up{job="[[ .Job ]]"} == 0
+    for: [[ .For ]]
+    labels:
+      severity: critical
+    annotations:
+      summary: Nomad exporter {{ $labels.instance }} is down
+  - alert: NomadUnreachable
+    expr: |
+      nomad_up == 0
+    for: [[ .For ]]
+    labels:
+      severity: critical
+    annotations:
+      summary: Nomad exporter {{ $labels.instance }} can't talk to nomad
+  - alert: NomadExporterStale
+    expr: |
+      time() - nomad_exporter_last_collect_success_timestamp > [[ .StaleAfterSeconds ]]
+    for: [[ .For ]]
+    labels:
+      severity: warning
+    annotations:
+      summary: Nomad exporter {{ $labels.instance }} collections have been failing for {{ $value | humanizeDuration }}
+  - alert: NomadNodeNotReady
+    expr: |
+      nomad_node_info{status!="ready"} == 1
+    for: [[ .NodeNotReadyFor ]]
+    labels:
+      severity: warning
+    annotations:
+      summary: Nomad node {{ $labels.name }} in {{ $labels.datacenter }} is {{ $labels.status }}
+  - alert: NomadZombieAllocations
+    expr: |
+      nomad_allocation_zombies > [[ .ZombiesThreshold ]]
+    for: [[ .For ]]
+    labels:
+      severity: warning
+    annotations:
+      summary: There are {{ $value }} zombie allocations running on nodes that are not ready
+  - alert: NomadBlockedEvals
+    expr: |
+      nomad_evals_total{status="blocked"} > [[ .BlockedEvalsThreshold ]]
+    for: [[ .For ]]
+    labels:
+      severity: warning
+    annotations:
+      summary: There are {{ $value }} blocked evaluations, the cluster may be out of capacity
+  - alert: NomadFailedDeployments
+    expr: |
+      sum by (job_id) (nomad_deployments_total{status="failed"}) > [[ .FailedDeploymentThreshold ]]
+    for: [[ .For ]]
+    labels:
+      severity: warning
+    annotations:
+      summary: Job {{ $labels.job_id }} has {{ $value }} failed deployments
+`))
+
+// runAlertRules parses the alert-rules subcommand arguments and writes the
+// alerting rules to w
+func runAlertRules(arguments []string, w io.Writer) error {
+	var c alertRulesConfig
+
+	flags := flag.NewFlagSet("alert-rules", flag.ExitOnError)
+	flags.StringVar(&c.Group, "group", "nomad", "Name of the rules group.")
+	flags.StringVar(&c.Job, "job", "nomad-exporter", "Prometheus job name the exporter is scraped with.")
+	flags.StringVar(&c.For, "for", "5m", "How long a condition has to hold before alerting.")
+	flags.StringVar(&c.NodeNotReadyFor, "node-not-ready.for", "10m", "How long a node has to be not ready before alerting.")
+	flags.StringVar(&c.StaleAfter, "stale.after", "10m", "Alert when no collection succeeded for this long.")
+	flags.IntVar(&c.ZombiesThreshold, "zombies.threshold", 0, "Alert when there are more zombie allocations than this.")
+	flags.IntVar(&c.BlockedEvalsThreshold, "blocked-evals.threshold", 0, "Alert when there are more blocked evaluations than this.")
+	flags.IntVar(&c.FailedDeploymentThreshold, "failed-deployments.threshold", 0, "Alert when a job has more failed deployments than this.")
+	flags.Parse(arguments)
+
+	for _, d := range []string{c.For, c.NodeNotReadyFor, c.StaleAfter} {
+		if _, err := model.ParseDuration(d); err != nil {
+			return fmt.Errorf("invalid duration %q: %s", d, err)
+		}
+	}
+
+	return alertRulesTemplate.Execute(w, c)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// identified are the resources whose path goes on with an identifier
+var identified = map[string]bool{
+	"allocation": true,
+	"deployment": true,
+	"evaluation": true,
+	"job":        true,
+	"node":       true,
+}
+
+// subResources are the paths that follow an identifier
+var subResources = map[string]bool{
+	"allocations": true,
+	"deployment":  true,
+	"deployments": true,
+	"evaluations": true,
+	"stats":       true,
+	"summary":     true,
+	"versions":    true,
+}
+
+// apiEndpoint is the path of the request with the identifiers replaced, so
+// there is a handful of endpoints however many nodes and jobs there are. Job
+// identifiers may contain slashes, everything up to the sub resource is the
+// identifier
+func apiEndpoint(path string) string {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	prefix := 2
+	if len(parts) > 2 && parts[1] == "client" && parts[2] == "allocation" {
+		prefix = 3
+	}
+	if len(parts) <= prefix || !identified[parts[prefix-1]] {
+		return path
+	}
+
+	endpoint := "/" + strings.Join(parts[:prefix], "/") + "/:id"
+	if last := parts[len(parts)-1]; len(parts) > prefix+1 && subResources[last] {
+		endpoint += "/" + last
+	}
+	return endpoint
+}
+
+// apiCallsTransport counts the requests to nomad and the bytes of their
+// responses by endpoint, retries included, to tell the load the exporter
+// puts on the servers
+type apiCallsTransport struct {
+	next http.RoundTripper
+}
+
+func withAPICallsTransport(c *http.Client) {
+	c.Transport = &apiCallsTransport{next: c.Transport}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *apiCallsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	endpoint := apiEndpoint(r.URL.Path)
+	apiCalls.WithLabelValues(endpoint).Inc()
+
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingBody{
+		ReadCloser: resp.Body,
+		bytes:      apiResponseBytes.WithLabelValues(endpoint),
+	}
+	return resp, nil
+}
+
+// countingBody adds what is read from the body to the counter
+type countingBody struct {
+	io.ReadCloser
+	bytes prometheus.Counter
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes.Add(float64(n))
+	return n, err
+}
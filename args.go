@@ -3,15 +3,62 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
 )
 
 type args struct {
 	ShowVersion                     bool
+	Once                            bool
+	Bench                           bool
+	BenchNodes                      int
+	BenchJobs                       int
+	BenchAllocations                int
+	BenchRounds                     int
+	BenchLatency                    int
+	CardinalityTop                  int
+	ProbeTimeout                    int
+	WindowsServiceName              string
+	Mode                            string
 	ListenAddress                   string
+	AdminListenAddress              string
+	AdminTokenFile                  string
+	Snapshot                        bool
+	AccessLog                       bool
 	MetricsPath                     string
+	PushURL                         string
+	PushJob                         string
+	PushInterval                    int
+	OTLPEndpoint                    string
+	OTLPInterval                    int
+	WebhookURL                      string
+	WebhookDebounce                 int
+	StatsdAddress                   string
+	StatsdInterval                  int
+	TextfilePath                    string
+	TextfileInterval                int
 	NomadAddress                    string
 	NomadTimeout                    int
 	NomadWaitTime                   int
+	NomadTLSHandshakeTimeout        int
+	NomadKeepAlives                 bool
+	NomadMaxIdleConnsPerHost        int
+	NomadTokenFile                  string
+	NomadMaxRPS                     float64
+	NomadProxyURL                   string
+	NomadHeaders                    headerFlags
+	NomadConsulService              string
+	NomadConsulTag                  string
+	NomadConsulScheme               string
+	NomadConsulRefresh              int
+	NomadSRVRecord                  string
+	NomadSRVScheme                  string
+	NomadSRVRefresh                 int
+	ConsulAddress                   string
+	ConsulToken                     string
+	QueryStale                      bool
+	QueryOverrides                  string
 	TLSCaFile                       string
 	TLSCaPath                       string
 	TLSCert                         string
@@ -20,6 +67,13 @@ type args struct {
 	TLSServerName                   string
 	Debug                           bool
 	AllowStaleReads                 bool
+	CollectMode                     string
+	CollectEvery                    string
+	CollectBudget                   int
+	CacheFile                       string
+	RequireFirstCollect             bool
+	ElectionConsulKey               string
+	ElectionTTL                     int
 	NoPeerMetricsEnabled            bool
 	NoSerfMetricsEnabled            bool
 	NoNodeMetricsEnabled            bool
@@ -27,70 +81,269 @@ type args struct {
 	NoAllocationsMetricsEnabled     bool
 	NoEvalMetricsEnabled            bool
 	NoDeploymentMetricsEnabled      bool
+	NoIntegrationMetricsEnabled     bool
+	NoBrokerMetricsEnabled          bool
 	NoAllocationStatsMetricsEnabled bool
+	NoGoMetricsEnabled              bool
+	NoProcessMetricsEnabled         bool
 	Concurrency                     int
+	AllocationConcurrency           int
+	AllocationStatsConcurrency      int
+	NamespaceConcurrency            int
+	PageSize                        int
+	NodeCircuitFailures             int
+	NodeCircuitCooldown             int
+	LocalStatsInterval              int
+	ClusterLabel                    string
+	CumulativeCounters              bool
+	PendingThreshold                int
+	IncludeTerminalAllocations      bool
+	TerminalLookback                int
+	PerCPUMetrics                   bool
+	AllocationPortMetrics           bool
+	KeyringMetrics                  bool
+	PlacementMetrics                bool
+	PlacementMaxAge                 int
+	FederationMetrics               bool
+	FederationRegions               string
+	AllocationAggregation           string
+	AllocationTopK                  int
+	JobMetaKeys                     string
+	SeriesLimit                     int
+	RelabelConfigFile               string
+	MetricsConfigFile               string
+	CostConfigFile                  string
+	CompatLegacyNames               bool
+	VaultAddress                    string
+	VaultToken                      string
+	VaultNomadMount                 string
+	VaultNomadRole                  string
+	Config                          map[string]string
 }
 
-func parseArgs() args {
+// parseArgs parses the arguments of the serve, probe, check-config and
+// cardinality commands
+func parseArgs(command string, arguments []string) args {
 	var a args
 
-	flag.BoolVar(&a.ShowVersion, "version", false, "Print version information.")
-	flag.BoolVar(&a.Debug, "debug", false, "enable debug log level")
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+
+	flags.BoolVar(&a.ShowVersion, "version", false, "Print version information.")
+	flags.BoolVar(&a.Once, "once", false, "Collect once, print the metrics to stdout and exit.")
+	flags.BoolVar(&a.Bench, "bench", false, "Collect from a mock nomad api of -bench.* size, print the durations and api calls and exit.")
+	flags.IntVar(&a.BenchNodes, "bench.nodes", 100, "Number of nodes of the mock nomad api.")
+	flags.IntVar(&a.BenchJobs, "bench.jobs", 50, "Number of jobs of the mock nomad api.")
+	flags.IntVar(&a.BenchAllocations, "bench.allocations", 1000, "Number of allocations of the mock nomad api.")
+	flags.IntVar(&a.BenchRounds, "bench.rounds", 3, "Number of collections to run against the mock nomad api.")
+	flags.IntVar(&a.BenchLatency, "bench.latency", 0, "Latency of every call to the mock nomad api, in milliseconds.")
+	flags.IntVar(&a.CardinalityTop, "cardinality.top", 10, "Number of label values accounting for the most series the cardinality command lists.")
+	flags.IntVar(&a.ProbeTimeout, "probe.timeout", 5, "How long the probe command waits for nomad to answer, in seconds.")
+	flags.StringVar(&a.WindowsServiceName, "windows.service-name", "nomad-exporter", "Name of the windows service and of the event log source it logs to, when the service control manager starts the exporter.")
+	flags.BoolVar(&a.Debug, "debug", false, "enable debug log level")
+	flags.StringVar(&a.Mode, "mode", "cluster", "cluster collects cluster wide metrics from a server, client only collects the local nomad client node and allocations")
 
-	flag.StringVar(&a.ListenAddress,
-		"web.listen-address", ":9441", "Address to listen on for web interface and telemetry.")
-	flag.StringVar(&a.MetricsPath,
+	flags.StringVar(&a.ListenAddress,
+		"web.listen-address", ":9441", "Comma separated addresses to listen on for web interface and telemetry, like [::]:9441,127.0.0.1:9441. Empty to not listen at all.")
+	flags.StringVar(&a.MetricsPath,
 		"web.telemetry-path", "/metrics", "Path under which to expose metrics.")
+	flags.StringVar(&a.AdminListenAddress,
+		"web.admin-listen-address", "", "Comma separated addresses to serve pprof, /healthz and the exporter's own metrics on, apart from the nomad metrics. Empty to serve them on -web.listen-address.")
+	flags.StringVar(&a.AdminTokenFile,
+		"web.admin-token-file", "", "File with the bearer token to authenticate the admin API with, the API is disabled when empty.")
+	flags.BoolVar(&a.AccessLog,
+		"web.access-log", false, "Log every request to the exporter endpoints.")
+	flags.BoolVar(&a.Snapshot,
+		"web.snapshot", false, "Serve the nodes, allocations, jobs and deployments the last collection read as JSON on /api/v1/snapshot, along the admin endpoints. Needs -web.admin-listen-address or -web.admin-token-file.")
+
+	flags.StringVar(&a.PushURL,
+		"push.url", "", "Pushgateway compatible URL to periodically push metrics to, disabled when empty.")
+	flags.StringVar(&a.PushJob,
+		"push.job", "nomad-exporter", "Job name to push metrics with.")
+	flags.IntVar(&a.PushInterval,
+		"push.interval", 60, "Interval to push metrics at. In seconds.")
+
+	flags.StringVar(&a.OTLPEndpoint,
+		"otlp.endpoint", "", "OTLP/HTTP metrics endpoint to periodically push metrics to, as in http://collector:4318/v1/metrics. Disabled when empty.")
+	flags.IntVar(&a.OTLPInterval,
+		"otlp.interval", 60, "Interval to push OTLP metrics at. In seconds.")
+
+	flags.StringVar(&a.WebhookURL,
+		"webhook.url", "", "Comma separated URLs to post the zombie allocation, ineligible node and failed deployment events to, disabled when empty.")
+	flags.IntVar(&a.WebhookDebounce,
+		"webhook.debounce", 300, "How long an event about the same object isn't posted again. In seconds.")
+
+	flags.StringVar(&a.StatsdAddress,
+		"statsd.address", "", "DogStatsD host:port to periodically send metrics to over UDP. Disabled when empty.")
+	flags.IntVar(&a.StatsdInterval,
+		"statsd.interval", 10, "Interval to send DogStatsD metrics at. In seconds.")
+
+	flags.StringVar(&a.TextfilePath,
+		"output.textfile", "", "File to periodically write the metrics to for node_exporter's textfile collector. Disabled when empty.")
+	flags.IntVar(&a.TextfileInterval,
+		"output.textfile-interval", 60, "Interval to write the textfile at. In seconds.")
 
 	nomadAddr := os.Getenv("NOMAD_ADDR")
 	if nomadAddr == "" {
 		nomadAddr = "http://localhost:4646"
 	}
-	flag.StringVar(&a.NomadAddress,
-		"nomad.address", nomadAddr, "HTTP API address of a Nomad server or agent.")
+	flags.StringVar(&a.NomadAddress,
+		"nomad.address", nomadAddr, "Comma separated HTTP API addresses of Nomad servers to fail over between, or unix:///path/to/socket for a local agent.")
 
-	flag.IntVar(&a.NomadTimeout,
+	flags.IntVar(&a.NomadTimeout,
 		"nomad.timeout", 500, "HTTP read timeout when talking to the Nomad agent. In milliseconds")
-	flag.IntVar(&a.NomadWaitTime,
+	flags.IntVar(&a.NomadWaitTime,
 		"nomad.waittime", 10, "Timeout to wait for the Nomad agent to deliver fresh data. In milliseconds.")
 
+	flags.Float64Var(&a.NomadMaxRPS,
+		"nomad.max-rps", 0, "Max requests per second to send to Nomad across all collectors. 0 disables the limit.")
+
+	flags.IntVar(&a.NomadTLSHandshakeTimeout,
+		"nomad.tls-handshake-timeout", 10000, "Timeout for the TLS handshake with the Nomad agent. In milliseconds.")
+	flags.BoolVar(&a.NomadKeepAlives,
+		"nomad.keep-alives", false, "Reuse the connections to the Nomad agent instead of opening one per request.")
+	flags.IntVar(&a.NomadMaxIdleConnsPerHost,
+		"nomad.max-idle-conns-per-host", 20, "Idle connections to keep open to the Nomad agent when reusing them.")
+
+	flags.StringVar(&a.NomadProxyURL,
+		"nomad.proxy-url", "", "Proxy to reach Nomad through. HTTPS_PROXY, HTTP_PROXY and NO_PROXY are used when empty.")
+	flags.Var(&a.NomadHeaders,
+		"nomad.header", "Header to add to every request to Nomad, as in \"Name: value\". Can be repeated.")
+
+	flags.StringVar(&a.NomadConsulService,
+		"nomad.consul-service", "", "Consul service to discover the Nomad servers from instead of -nomad.address. Disabled when empty.")
+	flags.StringVar(&a.NomadConsulTag,
+		"nomad.consul-tag", "http", "Tag of the Consul service instances serving the Nomad HTTP API.")
+	flags.StringVar(&a.NomadConsulScheme,
+		"nomad.consul-scheme", "http", "Scheme to talk to the discovered Nomad servers with, http or https.")
+	flags.IntVar(&a.NomadConsulRefresh,
+		"nomad.consul-refresh", 60, "Interval to refresh the discovered Nomad servers at. In seconds.")
+
+	flags.StringVar(&a.NomadSRVRecord,
+		"nomad.srv-record", "", "DNS SRV record to discover the Nomad servers from instead of -nomad.address. Disabled when empty.")
+	flags.StringVar(&a.NomadSRVScheme,
+		"nomad.srv-scheme", "http", "Scheme to talk to the Nomad servers of the SRV record with, http or https.")
+	flags.IntVar(&a.NomadSRVRefresh,
+		"nomad.srv-refresh", 60, "Interval to look the SRV record up again at. In seconds.")
+
+	consulAddr := os.Getenv("CONSUL_HTTP_ADDR")
+	if consulAddr == "" {
+		consulAddr = "http://127.0.0.1:8500"
+	} else if !strings.Contains(consulAddr, "://") {
+		consulAddr = "http://" + consulAddr
+	}
+	flags.StringVar(&a.ConsulAddress,
+		"consul.address", consulAddr, "HTTP API address of the Consul agent to discover the Nomad servers from and to elect the active exporter with.")
+	flags.StringVar(&a.ConsulToken,
+		"consul.token", os.Getenv("CONSUL_HTTP_TOKEN"), "Consul ACL token to discover the Nomad servers and to elect the active exporter with.")
+	flags.StringVar(&a.ElectionConsulKey,
+		"election.consul-key", "", "Consul key to lock so only one exporter replica collects the cluster metrics. Disabled when empty.")
+	flags.IntVar(&a.ElectionTTL,
+		"election.ttl", 15, "TTL of the Consul session holding the election lock. In seconds.")
+
+	flags.StringVar(&a.NomadTokenFile,
+		"nomad.token-file", "", "File to read the Nomad ACL token from, reloaded when it changes. Takes precedence over NOMAD_TOKEN.")
+
+	flags.BoolVar(&a.QueryStale,
+		"query.stale", true, "Allow any server to answer the queries, not only the leader.")
+	flags.StringVar(&a.QueryOverrides,
+		"query.overrides", "", "Comma separated per collector query options as collector=stale|consistent[:waittime], for nodes, allocations, jobs, evals and deployments.")
+
 	tlsCaFile := os.Getenv("NOMAD_CACERT")
-	flag.StringVar(&a.TLSCaFile,
+	flags.StringVar(&a.TLSCaFile,
 		"tls.ca-file", tlsCaFile, "ca-file path to a PEM-encoded CA cert file to use to verify the connection to nomad server")
 
 	tlsCaPath := os.Getenv("NOMAD_CAPATH")
-	flag.StringVar(&a.TLSCaPath,
+	flags.StringVar(&a.TLSCaPath,
 		"tls.ca-path", tlsCaPath, "ca-path is the path to a directory of PEM-encoded CA cert files to verify the connection to nomad server")
 
 	tlsCertFile := os.Getenv("NOMAD_CLIENT_CERT")
-	flag.StringVar(&a.TLSCert,
+	flags.StringVar(&a.TLSCert,
 		"tls.cert-file", tlsCertFile, "cert-file is the path to the client certificate for Nomad communication")
 
 	tlsCertKey := os.Getenv("NOMAD_CLIENT_KEY")
-	flag.StringVar(&a.TLSKey,
+	flags.StringVar(&a.TLSKey,
 		"tls.key-file", tlsCertKey, "key-file is the path to the key for cert-file")
 
 	tlsSkipVerify := os.Getenv("NOMAD_SKIP_VERIFY")
-	flag.BoolVar(&a.TLSInsecure,
+	flags.BoolVar(&a.TLSInsecure,
 		"tls.insecure", tlsSkipVerify != "", "insecure enables or disables SSL verification")
 
 	tlsServerName := os.Getenv("NOMAD_SNI_TLS_SERVER_NAME")
-	flag.StringVar(&a.TLSServerName,
+	flags.StringVar(&a.TLSServerName,
 		"tls.tls-server-name", tlsServerName, "tls-server-name sets the SNI for Nomad ssl connection")
 
-	flag.BoolVar(&a.AllowStaleReads, "allow-stale-reads", false, "allow to read metrics from a non-leader server")
+	// nomad.* aliases of the tls flags, named as the nomad cli ones
+	flags.StringVar(&a.TLSCaFile, "nomad.ca-file", tlsCaFile, "same as -tls.ca-file")
+	flags.StringVar(&a.TLSCert, "nomad.cert-file", tlsCertFile, "same as -tls.cert-file")
+	flags.StringVar(&a.TLSKey, "nomad.key-file", tlsCertKey, "same as -tls.key-file")
+	flags.StringVar(&a.TLSServerName, "nomad.tls-server-name", tlsServerName, "same as -tls.tls-server-name")
+	flags.BoolVar(&a.TLSInsecure, "nomad.tls-skip-verify", tlsSkipVerify != "", "same as -tls.insecure")
+
+	flags.StringVar(&a.VaultAddress,
+		"vault.address", os.Getenv("VAULT_ADDR"), "address of the Vault server to fetch the Nomad ACL token from")
+	flags.StringVar(&a.VaultToken,
+		"vault.token", os.Getenv("VAULT_TOKEN"), "token used to authenticate against Vault")
+	flags.StringVar(&a.VaultNomadMount,
+		"vault.nomad-mount", "nomad", "path where the Vault Nomad secrets engine is mounted")
+	flags.StringVar(&a.VaultNomadRole,
+		"vault.nomad-role", "", "Vault Nomad secrets engine role to fetch the ACL token for, enables Vault integration")
+
+	flags.BoolVar(&a.AllowStaleReads, "allow-stale-reads", false, "allow to read metrics from a non-leader server, same as -collect.mode=followers-stale")
+	flags.StringVar(&a.CollectMode, "collect.mode", "leader-only", "when to collect cluster metrics: leader-only, followers-stale or always")
+	flags.BoolVar(&a.RequireFirstCollect, "startup.require-first-collect", false, "Answer 503 on the metrics and status endpoints until a collection succeeded")
+	flags.StringVar(&a.CacheFile, "cache.file", "", "File to keep the fetched nodes and jobs in across restarts, so only what changed is fetched on start")
+	flags.IntVar(&a.CollectBudget, "collect.budget", 0, "Abort the collections running longer than this, serving what they collected so far, in seconds. 0 disables it")
+	flags.StringVar(&a.CollectEvery, "collect.every", "", "Comma separated collector=n to run the collector every nth collection only, serving its last metrics in between")
 
-	flag.BoolVar(&a.NoPeerMetricsEnabled, "no-peer-metrics", false, "disable peer metrics collection")
-	flag.BoolVar(&a.NoSerfMetricsEnabled, "no-serf-metrics", false, "disable serf metrics collection")
-	flag.BoolVar(&a.NoNodeMetricsEnabled, "no-node-metrics", false, "disable node metrics collection")
-	flag.BoolVar(&a.NoJobMetricsEnabled, "no-jobs-metrics", false, "disable jobs metrics collection")
-	flag.BoolVar(&a.NoAllocationsMetricsEnabled, "no-allocations-metrics", false, "disable allocations metrics collection")
-	flag.BoolVar(&a.NoEvalMetricsEnabled, "no-eval-metrics", false, "disable eval metrics collection")
-	flag.BoolVar(&a.NoDeploymentMetricsEnabled, "no-deployment-metrics", false, "disable deployment metrics collection")
-	flag.BoolVar(&a.NoAllocationStatsMetricsEnabled, "no-allocation-stats-metrics", false, "disable stats metrics collection")
-	flag.IntVar(&a.Concurrency, "concurrency", 20, "max number of goroutines to launch concurrently when poking the API")
+	flags.BoolVar(&a.NoPeerMetricsEnabled, "no-peer-metrics", false, "disable peer metrics collection")
+	flags.BoolVar(&a.NoSerfMetricsEnabled, "no-serf-metrics", false, "disable serf metrics collection")
+	flags.BoolVar(&a.NoNodeMetricsEnabled, "no-node-metrics", false, "disable node metrics collection")
+	flags.BoolVar(&a.NoJobMetricsEnabled, "no-jobs-metrics", false, "disable jobs metrics collection")
+	flags.BoolVar(&a.NoAllocationsMetricsEnabled, "no-allocations-metrics", false, "disable allocations metrics collection")
+	flags.BoolVar(&a.NoEvalMetricsEnabled, "no-eval-metrics", false, "disable eval metrics collection")
+	flags.BoolVar(&a.NoDeploymentMetricsEnabled, "no-deployment-metrics", false, "disable deployment metrics collection")
+	flags.BoolVar(&a.NoBrokerMetricsEnabled, "no-broker-metrics", false, "disable eval broker and plan queue metrics collection")
+	flags.BoolVar(&a.NoIntegrationMetricsEnabled, "no-integration-metrics", false, "disable vault and consul integration metrics collection")
+	flags.BoolVar(&a.NoAllocationStatsMetricsEnabled, "no-allocation-stats-metrics", false, "disable stats metrics collection")
+	flags.BoolVar(&a.NoGoMetricsEnabled, "no-go-metrics", false, "disable go runtime metrics of the exporter")
+	flags.BoolVar(&a.NoProcessMetricsEnabled, "no-process-metrics", false, "disable process metrics of the exporter")
+	flags.IntVar(&a.Concurrency, "concurrency", 20, "max number of goroutines to launch concurrently when poking the API")
+	flags.IntVar(&a.AllocationConcurrency, "concurrency.allocations", 20, "max number of allocations to fetch concurrently")
+	flags.IntVar(&a.AllocationStatsConcurrency, "concurrency.allocation-stats", 20, "max number of allocation stats to fetch concurrently")
+	flags.IntVar(&a.PageSize, "nomad.page-size", 0, "list the jobs, allocations and evaluations this many at a time, needs nomad 1.3. 0 lists them whole")
+	flags.IntVar(&a.NamespaceConcurrency, "concurrency.namespaces", 0, "list the jobs, allocations, evaluations and deployments of every namespace apart, this many at once, instead of in a single query. 0 disables it")
+	flags.IntVar(&a.NodeCircuitFailures, "node-circuit.failures", 0, "stop querying a node after this many consecutive failures, 0 disables it")
+	flags.IntVar(&a.NodeCircuitCooldown, "node-circuit.cooldown", 300, "how long to stop querying a failing node for, in seconds")
+	flags.IntVar(&a.LocalStatsInterval, "local-stats-interval", 0, "poll stats of the allocations running on the local nomad client in the background with this interval, in milliseconds. 0 disables it")
+	flags.BoolVar(&a.CumulativeCounters, "cumulative-counters", false, "export cumulative cpu values as counters with a _total suffix instead of gauges")
+	flags.IntVar(&a.PendingThreshold, "allocations.pending-threshold", 300, "count allocations pending for longer than this as stale, in seconds")
+	flags.BoolVar(&a.IncludeTerminalAllocations, "allocations.include-terminal", false, "count the allocations that completed, failed or were stopped within the terminal lookback in nomad_allocation, with their task states and exits")
+	flags.IntVar(&a.TerminalLookback, "allocations.terminal-lookback", 3600, "count the terminal allocations modified within this with -allocations.include-terminal, in seconds")
+	flags.StringVar(&a.AllocationAggregation, "allocations.aggregation", collector.AggregationAlloc, "export allocation stats per alloc, summed per job and task group with job, or for the top allocations of every node only with topk")
+	flags.BoolVar(&a.IncludeTerminalAllocations, "allocs.include-terminal", false, "same as -allocations.include-terminal")
+	flags.StringVar(&a.AllocationAggregation, "allocs.aggregation", collector.AggregationAlloc, "same as -allocations.aggregation")
+	flags.IntVar(&a.AllocationTopK, "allocations.top-k", 5, "how many allocations of every node using the most cpu, and using the most memory, get their own stats with -allocations.aggregation topk")
+	flags.BoolVar(&a.PerCPUMetrics, "node-per-cpu-metrics", false, "export the usage of every cpu core of the nodes")
+	flags.BoolVar(&a.AllocationPortMetrics, "allocation-port-metrics", false, "export an info metric for every port allocated to the running allocations")
+	flags.BoolVar(&a.KeyringMetrics, "keyring-metrics", false, "export the count and age of the root encryption keys, needs nomad 1.4 and a management token")
+	flags.BoolVar(&a.PlacementMetrics, "placement-metrics", false, "export the node scores of the recent placements, fetches every recent allocation, for debugging")
+	flags.IntVar(&a.PlacementMaxAge, "placement.max-age", 3600, "export the node scores of the allocations created within this, in seconds")
+	flags.BoolVar(&a.FederationMetrics, "federation-metrics", false, "export the nodes and jobs of every federated region with a region label, through the servers of the connected region")
+	flags.StringVar(&a.FederationRegions, "federation.regions", "", "comma separated regions to export with -federation-metrics, every region when empty")
+	flags.StringVar(&a.JobMetaKeys, "job-meta-keys", "", "comma separated job meta keys to export as labels of nomad_job_info, disabled when empty")
+	flags.BoolVar(&a.CompatLegacyNames, "compat.legacy-names", false, "export the metrics whose names don't follow the prometheus conventions under corrected names as well, to migrate dashboards")
+	flags.StringVar(&a.MetricsConfigFile, "metrics.config-file", "", "JSON file switching individual metric families on and off")
+	flags.StringVar(&a.RelabelConfigFile, "relabel.config-file", "", "JSON file with rules to drop or rewrite labels of the exported series")
+	flags.StringVar(&a.CostConfigFile, "cost.config-file", "", "JSON file with the hourly cost of the nodes by node class or attribute, to export the cost of the nodes and jobs")
+	flags.IntVar(&a.SeriesLimit, "series-limit", 0, "drop the metric families with more series than this from every scrape, 0 disables it")
+	flags.StringVar(&a.ClusterLabel, "cluster-label", "", "stamp every exported series with a nomad_cluster label with this value")
 
-	flag.Parse()
+	flags.Parse(arguments)
+
+	if a.AllowStaleReads && a.CollectMode == "leader-only" {
+		a.CollectMode = "followers-stale"
+	}
 
+	a.Config = effectiveConfig(flags)
 	return a
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/internal/mocknomad"
+)
+
+// bench collects from a mock nomad api of the configured size, reporting how
+// long every collection took and the api calls it made
+func bench(a args) {
+	mock := mocknomad.New(mocknomad.Config{
+		Nodes:       a.BenchNodes,
+		Jobs:        a.BenchJobs,
+		Allocations: a.BenchAllocations,
+		Latency:     time.Duration(a.BenchLatency) * time.Millisecond,
+	})
+	defer mock.Close()
+
+	a.NomadAddress = mock.URL()
+	a.NomadConsulService = ""
+	a.NomadSRVRecord = ""
+	exporter := mustExporter(a)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+
+	fmt.Printf("%d nodes, %d jobs, %d allocations\n\n", a.BenchNodes, a.BenchJobs, a.BenchAllocations)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "round\tduration\tseries\tapi calls")
+
+	var rounds []map[string]int
+	for round := 1; round <= a.BenchRounds; round++ {
+		mock.Reset()
+		start := time.Now()
+		mfs, err := registry.Gather()
+		duration := time.Since(start)
+		if err != nil {
+			logrus.Errorf("could not gather all metrics: %s", err)
+		}
+
+		var series int
+		for _, mf := range mfs {
+			series += len(mf.Metric)
+		}
+		calls := mock.Calls()
+		var total int
+		for _, n := range calls {
+			total += n
+		}
+		rounds = append(rounds, calls)
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\n", round, duration.Round(time.Millisecond), series, total)
+	}
+	w.Flush()
+
+	routes := make(map[string]bool)
+	for _, calls := range rounds {
+		for route := range calls {
+			routes[route] = true
+		}
+	}
+	sorted := make([]string, 0, len(routes))
+	for route := range routes {
+		sorted = append(sorted, route)
+	}
+	sort.Strings(sorted)
+
+	fmt.Println()
+	fmt.Fprint(w, "api calls")
+	for round := range rounds {
+		fmt.Fprintf(w, "\tround %d", round+1)
+	}
+	fmt.Fprintln(w)
+	for _, route := range sorted {
+		fmt.Fprint(w, route)
+		for _, calls := range rounds {
+			fmt.Fprintf(w, "\t%d", calls[route])
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
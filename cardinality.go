@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+)
+
+// labelValue is a label pair and how many series carry it
+type labelValue struct {
+	name, value string
+	series      int
+}
+
+// cardinality collects once and reports how many series every metric family
+// has and which label values account for the most series, to estimate the
+// impact on the TSDB before enabling a collector. The series limit isn't
+// applied, so the families it would drop are reported too
+func cardinality(a args, w io.Writer) error {
+	if a.Debug {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	var rules []*relabelRule
+	if a.RelabelConfigFile != "" {
+		var err error
+		if rules, err = loadRelabelRules(a.RelabelConfigFile); err != nil {
+			return err
+		}
+	}
+
+	exporter := mustExporter(a)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	mfs, err := metricsGatherer(familiesOf(a, exporter, registry), a.ClusterLabel, rules, 0, exporter.Collections).Gather()
+	if err != nil {
+		logrus.Errorf("could not gather all metrics: %s", err)
+	}
+	writeCardinality(w, mfs, a.CardinalityTop)
+	return nil
+}
+
+// seriesOf is how many series the metric is stored as, a histogram has one
+// per bucket, +Inf included, and the sum and count
+func seriesOf(m *dto.Metric) int {
+	switch {
+	case m.Histogram != nil:
+		return len(m.Histogram.Bucket) + 3
+	case m.Summary != nil:
+		return len(m.Summary.Quantile) + 2
+	}
+	return 1
+}
+
+func familySeries(mf *dto.MetricFamily) int {
+	var series int
+	for _, m := range mf.Metric {
+		series += seriesOf(m)
+	}
+	return series
+}
+
+func writeCardinality(out io.Writer, mfs []*dto.MetricFamily, top int) {
+	sort.SliceStable(mfs, func(i, j int) bool {
+		return familySeries(mfs[i]) > familySeries(mfs[j])
+	})
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "family\tseries\tdistinct label values")
+
+	var total int
+	values := make(map[[2]string]int)
+	for _, mf := range mfs {
+		total += familySeries(mf)
+
+		distinct := make(map[string]map[string]bool)
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				if distinct[l.GetName()] == nil {
+					distinct[l.GetName()] = make(map[string]bool)
+				}
+				distinct[l.GetName()][l.GetValue()] = true
+				values[[2]string{l.GetName(), l.GetValue()}] += seriesOf(m)
+			}
+		}
+
+		names := make([]string, 0, len(distinct))
+		for name := range distinct {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if len(distinct[names[i]]) != len(distinct[names[j]]) {
+				return len(distinct[names[i]]) > len(distinct[names[j]])
+			}
+			return names[i] < names[j]
+		})
+		labels := make([]string, len(names))
+		for i, name := range names {
+			labels[i] = fmt.Sprintf("%s=%d", name, len(distinct[name]))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", mf.GetName(), familySeries(mf), strings.Join(labels, " "))
+	}
+	fmt.Fprintf(w, "total\t%d\t\n", total)
+	w.Flush()
+
+	sorted := make([]labelValue, 0, len(values))
+	for pair, series := range values {
+		sorted = append(sorted, labelValue{pair[0], pair[1], series})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].series != sorted[j].series {
+			return sorted[i].series > sorted[j].series
+		}
+		if sorted[i].name != sorted[j].name {
+			return sorted[i].name < sorted[j].name
+		}
+		return sorted[i].value < sorted[j].value
+	})
+	if top < len(sorted) {
+		sorted = sorted[:top]
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(w, "label value\tseries")
+	for _, v := range sorted {
+		fmt.Fprintf(w, "%s=%q\t%d\n", v.name, v.value, v.series)
+	}
+	w.Flush()
+}
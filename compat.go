@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// correctedName is the name a family is exported under as well with
+// -compat.legacy-names, and the factor converting its values to base units
+type correctedName struct {
+	name    string
+	factor  float64
+	counter bool
+}
+
+// renamedFamilies are the families whose corrected name doesn't follow from
+// the suffix rules
+var renamedFamilies = map[string]correctedName{
+	"nomad_allocation_memory_rss_bytes_limit":  {name: "nomad_allocation_memory_rss_limit_bytes", factor: 1},
+	"nomad_allocation_cpu_throttle_time":       {name: "nomad_allocation_cpu_throttled_seconds_total", factor: 1e-9, counter: true},
+	"nomad_allocation_cpu_throttle_time_total": {name: "nomad_allocation_cpu_throttled_seconds_total", factor: 1e-9, counter: true},
+}
+
+// correct returns the name following the prometheus conventions of the
+// family, when its name doesn't: gauges don't end in _total, and the values
+// are in base units, hertz rather than megahertz and ratios rather than
+// percents
+func correct(mf *dto.MetricFamily) (correctedName, bool) {
+	name := mf.GetName()
+	if c, ok := renamedFamilies[name]; ok {
+		return c, true
+	}
+
+	switch {
+	case mf.GetType() == dto.MetricType_GAUGE && strings.HasSuffix(name, "_total"):
+		return correctedName{name: strings.TrimSuffix(name, "_total"), factor: 1}, true
+	case strings.HasSuffix(name, "_megahertz"):
+		return correctedName{name: strings.TrimSuffix(name, "_megahertz") + "_hertz", factor: 1e6}, true
+	case strings.HasSuffix(name, "_percent"):
+		return correctedName{name: strings.TrimSuffix(name, "_percent") + "_ratio", factor: 0.01}, true
+	}
+	return correctedName{}, false
+}
+
+// compatGatherer exports the families that don't follow the prometheus
+// conventions under their corrected name along with their legacy one, so
+// dashboards can move to the corrected names before the legacy ones go. A
+// corrected name that's already the name of another family is skipped
+func compatGatherer(g prometheus.Gatherer, known map[string]bool) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		for _, mf := range mfs {
+			c, ok := correct(mf)
+			if !ok || known[c.name] {
+				continue
+			}
+
+			corrected := proto.Clone(mf).(*dto.MetricFamily)
+			corrected.Name = proto.String(c.name)
+			if c.counter {
+				corrected.Type = dto.MetricType_COUNTER.Enum()
+			}
+			for _, m := range corrected.Metric {
+				scale(m, c.factor, c.counter)
+			}
+			mfs = append(mfs, corrected)
+		}
+		sort.Slice(mfs, func(i, j int) bool { return mfs[i].GetName() < mfs[j].GetName() })
+		return mfs, err
+	})
+}
+
+// scale multiplies the value of a gauge or a counter, turning it into a
+// counter when asked
+func scale(m *dto.Metric, factor float64, counter bool) {
+	var value float64
+	switch {
+	case m.Gauge != nil:
+		value = m.Gauge.GetValue()
+	case m.Counter != nil:
+		value = m.Counter.GetValue()
+	case m.Untyped != nil:
+		value = m.Untyped.GetValue()
+	default:
+		return
+	}
+	value *= factor
+
+	if counter {
+		m.Gauge, m.Untyped = nil, nil
+		m.Counter = &dto.Counter{Value: proto.Float64(value)}
+		return
+	}
+	switch {
+	case m.Gauge != nil:
+		m.Gauge.Value = proto.Float64(value)
+	case m.Counter != nil:
+		m.Counter.Value = proto.Float64(value)
+	case m.Untyped != nil:
+		m.Untyped.Value = proto.Float64(value)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
+)
+
+// consulDiscovery finds the nomad servers among the healthy instances of a
+// consul service, and keeps the failover addresses up to date with them
+type consulDiscovery struct {
+	address  string
+	token    string
+	service  string
+	tag      string
+	scheme   string
+	interval time.Duration
+	client   *http.Client
+}
+
+type consulServiceEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+}
+
+func newConsulDiscovery(a args) *consulDiscovery {
+	return &consulDiscovery{
+		address:  strings.TrimSuffix(a.ConsulAddress, "/"),
+		token:    a.ConsulToken,
+		service:  a.NomadConsulService,
+		tag:      a.NomadConsulTag,
+		scheme:   a.NomadConsulScheme,
+		interval: time.Duration(a.NomadConsulRefresh) * time.Second,
+		client:   cleanhttp.DefaultClient(),
+	}
+}
+
+// Start discovers the servers and keeps refreshing them in the background
+func (d *consulDiscovery) Start(t *failoverTransport) error {
+	if err := d.refresh(t); err != nil {
+		return err
+	}
+
+	go func() {
+		for range time.Tick(d.interval) {
+			if err := d.refresh(t); err != nil {
+				collector.LogError(err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *consulDiscovery) refresh(t *failoverTransport) error {
+	addresses, err := d.discover()
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return fmt.Errorf("no healthy instances of consul service %s", d.service)
+	}
+	logrus.Debugf("Discovered nomad addresses %s", strings.Join(addresses, ", "))
+	return t.set(addresses)
+}
+
+func (d *consulDiscovery) discover() ([]string, error) {
+	query := url.Values{"passing": {"true"}}
+	if d.tag != "" {
+		query.Set("tag", d.tag)
+	}
+	req, err := http.NewRequest("GET",
+		fmt.Sprintf("%s/v1/health/service/%s?%s", d.address, url.PathEscape(d.service), query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.token != "" {
+		req.Header.Set("X-Consul-Token", d.token)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not query consul service %s: %s", d.service, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not query consul service %s: unexpected status code %d", d.service, resp.StatusCode)
+	}
+
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("could not decode consul service %s: %s", d.service, err)
+	}
+
+	addresses := make([]string, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		addresses = append(addresses,
+			fmt.Sprintf("%s://%s", d.scheme, net.JoinHostPort(host, strconv.Itoa(e.Service.Port))))
+	}
+	return addresses, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
+)
+
+// consulElection elects the exporter replica that collects the cluster
+// metrics by holding a consul lock. The lock is held through a session with
+// a TTL, so it's released when the replica holding it stops renewing it
+type consulElection struct {
+	address string
+	token   string
+	key     string
+	ttl     time.Duration
+	client  *http.Client
+
+	mu      sync.Mutex
+	session string
+	active  bool
+}
+
+func newConsulElection(a args) (*consulElection, error) {
+	if a.ElectionTTL < 10 || a.ElectionTTL > 86400 {
+		return nil, fmt.Errorf("invalid election ttl %d, consul accepts 10 to 86400 seconds", a.ElectionTTL)
+	}
+	return &consulElection{
+		address: strings.TrimSuffix(a.ConsulAddress, "/"),
+		token:   a.ConsulToken,
+		key:     strings.Trim(a.ElectionConsulKey, "/"),
+		ttl:     time.Duration(a.ElectionTTL) * time.Second,
+		client:  cleanhttp.DefaultClient(),
+	}, nil
+}
+
+// Active implements collector.Election
+func (c *consulElection) Active() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active
+}
+
+// run keeps the session alive and tries to acquire the lock twice per TTL
+func (c *consulElection) run() {
+	for {
+		active, err := c.campaign()
+		if err != nil {
+			collector.LogError(fmt.Errorf("leader election failed: %s", err))
+		}
+
+		c.mu.Lock()
+		switch {
+		case active && !c.active:
+			logrus.Infof("Acquired lock %s, collecting the cluster metrics", c.key)
+		case !active && c.active:
+			logrus.Warnf("Lost lock %s, standing by", c.key)
+		}
+		c.active = active
+		c.mu.Unlock()
+
+		var value float64
+		if active {
+			value = 1
+		}
+		electionActive.Set(value)
+
+		time.Sleep(c.ttl / 2)
+	}
+}
+
+// campaign renews the session, creating one when it expired, and acquires
+// the lock with it, which succeeds too when the session already holds it
+func (c *consulElection) campaign() (bool, error) {
+	if c.session != "" {
+		found, err := c.renew()
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			logrus.Warnf("consul session %s expired", c.session)
+			c.session = ""
+		}
+	}
+	if c.session == "" {
+		id, err := c.createSession()
+		if err != nil {
+			return false, err
+		}
+		c.session = id
+	}
+
+	var acquired bool
+	hostname, _ := os.Hostname()
+	path := fmt.Sprintf("/v1/kv/%s?acquire=%s", c.key, url.QueryEscape(c.session))
+	if _, err := c.put(path, []byte(hostname), &acquired); err != nil {
+		return false, fmt.Errorf("could not acquire lock %s: %s", c.key, err)
+	}
+	return acquired, nil
+}
+
+func (c *consulElection) createSession() (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"Name":     "nomad-exporter",
+		"TTL":      c.ttl.String(),
+		"Behavior": "delete",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var session struct {
+		ID string
+	}
+	if _, err := c.put("/v1/session/create", body, &session); err != nil {
+		return "", fmt.Errorf("could not create consul session: %s", err)
+	}
+	return session.ID, nil
+}
+
+// renew renews the session, returning whether it still exists
+func (c *consulElection) renew() (bool, error) {
+	found, err := c.put("/v1/session/renew/"+url.PathEscape(c.session), nil, nil)
+	if err != nil {
+		return false, fmt.Errorf("could not renew consul session %s: %s", c.session, err)
+	}
+	return found, nil
+}
+
+// put sends the body to consul and decodes the response into out unless
+// nil, returning false when the path isn't found
+func (c *consulElection) put(path string, body []byte, out interface{}) (bool, error) {
+	req, err := http.NewRequest("PUT", c.address+path, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		io.Copy(ioutil.Discard, resp.Body)
+		return false, nil
+	case resp.StatusCode != http.StatusOK:
+		io.Copy(ioutil.Discard, resp.Body)
+		return false, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	case out == nil:
+		io.Copy(ioutil.Discard, resp.Body)
+		return true, nil
+	}
+	return true, json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// splitAddresses splits the comma separated list of nomad addresses
+func splitAddresses(spec string) []string {
+	var addresses []string
+	for _, address := range strings.Split(spec, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// failoverTransport sends the requests to the active nomad address, and moves
+// on to the next one when it can't be reached. The active address sticks
+// until it fails
+type failoverTransport struct {
+	next http.RoundTripper
+
+	mu        sync.Mutex
+	addresses []*url.URL
+	active    int
+}
+
+func withFailoverTransport(c *http.Client, addresses []string) (*failoverTransport, error) {
+	t := &failoverTransport{next: c.Transport}
+	if err := t.set(addresses); err != nil {
+		return nil, err
+	}
+	c.Transport = t
+	return t, nil
+}
+
+// set replaces the addresses, the active one sticks if it's still there
+func (t *failoverTransport) set(addresses []string) error {
+	urls := make([]*url.URL, 0, len(addresses))
+	for _, address := range addresses {
+		u, err := url.Parse(address)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid nomad address %q, expected http(s)://host:port", address)
+		}
+		urls = append(urls, u)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var active int
+	for i, u := range urls {
+		if len(t.addresses) > 0 && u.String() == t.addresses[t.active].String() {
+			active = i
+		}
+	}
+	t.addresses, t.active = urls, active
+	return nil
+}
+
+// Active returns the address requests are sent to
+func (t *failoverTransport) Active() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.addresses) == 0 {
+		return ""
+	}
+	return t.addresses[t.active].String()
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *failoverTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	addresses, active := t.addresses, t.active
+	t.mu.Unlock()
+
+	err := fmt.Errorf("no nomad address")
+	for i := range addresses {
+		n := (active + i) % len(addresses)
+		if i > 0 {
+			// requests with a body can only be retried if it can be read again
+			if r.Body != nil && r.GetBody == nil {
+				break
+			}
+			if r.Context().Err() != nil {
+				break
+			}
+		}
+
+		req := r.Clone(r.Context())
+		req.URL.Scheme = addresses[n].Scheme
+		req.URL.Host = addresses[n].Host
+		req.Host = addresses[n].Host
+		if i > 0 && r.GetBody != nil {
+			if req.Body, err = r.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		var resp *http.Response
+		resp, err = t.next.RoundTrip(req)
+		if err == nil {
+			if n != active {
+				t.failover(addresses[active], addresses[n])
+			}
+			return resp, nil
+		}
+		logrus.Debugf("nomad address %s failed: %s", addresses[n], err)
+	}
+	return nil, err
+}
+
+// failover moves the active address from one address to another, unless
+// another request already moved it or the addresses changed meanwhile
+func (t *failoverTransport) failover(from, to *url.URL) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.addresses) == 0 || t.addresses[t.active] != from {
+		return
+	}
+	for i, u := range t.addresses {
+		if u == to {
+			t.active = i
+			logrus.Warnf("nomad address %s is unreachable, failed over to %s", from, to)
+			return
+		}
+	}
+}
+
+// Describe implements prometheus.Collector
+func (t *failoverTransport) Describe(ch chan<- *prometheus.Desc) {
+	ch <- endpointActive
+}
+
+// Collect implements prometheus.Collector
+func (t *failoverTransport) Collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, address := range t.addresses {
+		var active float64
+		if i == t.active {
+			active = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			endpointActive, prometheus.GaugeValue, active, address.String(),
+		)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
+)
+
+// familiesConfig switches individual metric families on and off, every
+// family is on unless switched off
+type familiesConfig struct {
+	Families map[string]bool `json:"families"`
+}
+
+// knownFamilies returns the names of every family the exporter can export,
+// whatever the flags, so a config file stays valid when a flag changes
+func knownFamilies(collectors ...prometheus.Collector) map[string]bool {
+	collectors = append(collectors,
+		buildInfo, configHashInfo, httpRequests, apiCalls, apiResponseBytes,
+		seriesLimitExceeded, rateLimitWait, webhookEvents, electionActive, &failoverTransport{},
+		prometheus.NewGoCollector(), prometheus.NewProcessCollector(os.Getpid(), ""),
+	)
+
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		for _, c := range collectors {
+			c.Describe(ch)
+		}
+		close(ch)
+	}()
+
+	families := make(map[string]bool)
+	for desc := range ch {
+		if name := collector.FamilyName(desc); name != "" {
+			families[name] = true
+		}
+	}
+	return families
+}
+
+// loadDisabledFamilies reads the families config at path and returns the
+// families switched off, rejecting the families the exporter doesn't know
+func loadDisabledFamilies(path string, known map[string]bool) (map[string]bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read metrics config: %s", err)
+	}
+
+	var config familiesConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("could not parse metrics config %s: %s", path, err)
+	}
+
+	var unknown []string
+	disabled := make(map[string]bool)
+	for name, enabled := range config.Families {
+		if !known[name] {
+			unknown = append(unknown, name)
+			continue
+		}
+		if !enabled {
+			disabled[name] = true
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown metric families in %s: %s", path, strings.Join(unknown, ", "))
+	}
+	return disabled, nil
+}
+
+// familiesGatherer drops the families switched off
+func familiesGatherer(g prometheus.Gatherer, disabled map[string]bool) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		kept := mfs[:0]
+		for _, mf := range mfs {
+			if !disabled[mf.GetName()] {
+				kept = append(kept, mf)
+			}
+		}
+		return kept, err
+	})
+}
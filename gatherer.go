@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+const clusterLabelName = "nomad_cluster"
+
+// clusterLabelGatherer stamps every gathered series with the cluster label
+func clusterLabelGatherer(g prometheus.Gatherer, cluster string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				m.Label = append(m.Label, &dto.LabelPair{
+					Name:  proto.String(clusterLabelName),
+					Value: proto.String(cluster),
+				})
+				sort.Sort(labelPairSorter(m.Label))
+			}
+		}
+		return mfs, err
+	})
+}
+
+// seriesLimitCounts remembers the last collection every family was dropped
+// from, the scrapes and the sinks gather the same collection more than once
+// and it's only counted once
+type seriesLimitCounts struct {
+	mu      sync.Mutex
+	counted map[string]uint64
+}
+
+var exceededCollections = &seriesLimitCounts{counted: make(map[string]uint64)}
+
+func (c *seriesLimitCounts) count(family string, series, limit int, collection uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if last, ok := c.counted[family]; ok && last == collection {
+		return
+	}
+	c.counted[family] = collection
+	logrus.Warnf("dropping metric family %s with %d series, over the limit of %d", family, series, limit)
+	seriesLimitExceeded.WithLabelValues(family).Inc()
+}
+
+// seriesLimitGatherer drops the metric families with more series than the
+// limit, so a runaway job can't flood prometheus. The drops are counted once
+// per collection, collection returns the number of the last one, and the
+// count is gathered after them so it's up to date in the same gather
+func seriesLimitGatherer(g prometheus.Gatherer, limit int, collection func() uint64) prometheus.Gatherer {
+	exceeded := prometheus.NewRegistry()
+	exceeded.MustRegister(seriesLimitExceeded)
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		id := collection()
+		kept := mfs[:0]
+		for _, mf := range mfs {
+			if len(mf.Metric) > limit {
+				exceededCollections.count(mf.GetName(), len(mf.Metric), limit, id)
+				continue
+			}
+			kept = append(kept, mf)
+		}
+
+		counts, cerr := exceeded.Gather()
+		if err == nil {
+			err = cerr
+		}
+		kept = append(kept, counts...)
+		sort.Slice(kept, func(i, j int) bool { return kept[i].GetName() < kept[j].GetName() })
+		return kept, err
+	})
+}
+
+type labelPairSorter []*dto.LabelPair
+
+func (s labelPairSorter) Len() int           { return len(s) }
+func (s labelPairSorter) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s labelPairSorter) Less(i, j int) bool { return s[i].GetName() < s[j].GetName() }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// headerFlags collects the repeated -nomad.header flags, header values can
+// have commas so they aren't a comma separated list
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
+// parseHeaders parses the "Name: value" headers
+func parseHeaders(headers []string) (http.Header, error) {
+	parsed := make(http.Header)
+	for _, header := range headers {
+		parts := strings.SplitN(header, ":", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("invalid header %q, expected Name: value", header)
+		}
+		parsed.Add(name, strings.TrimSpace(parts[1]))
+	}
+	return parsed, nil
+}
+
+// headerTransport adds static headers to every request, as the ones a
+// reverse proxy in front of nomad may ask for
+type headerTransport struct {
+	next    http.RoundTripper
+	headers http.Header
+}
+
+func withHeaderTransport(c *http.Client, headers http.Header) {
+	c.Transport = &headerTransport{next: c.Transport, headers: headers}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *headerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	for name, values := range t.headers {
+		r.Header[name] = values
+	}
+	return t.next.RoundTrip(r)
+}
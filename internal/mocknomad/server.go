@@ -0,0 +1,380 @@
+// Package mocknomad serves a fake nomad api with generated nodes, jobs and
+// allocations, counting the calls made to it, to measure how the collector
+// scales without a real cluster
+package mocknomad
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Config sizes the simulated cluster
+type Config struct {
+	Nodes       int
+	Jobs        int
+	Allocations int
+	// Latency is added to every call, as a real api would take
+	Latency time.Duration
+}
+
+// Server is a running mock nomad api
+type Server struct {
+	config Config
+	server *httptest.Server
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// New starts a mock nomad api
+func New(c Config) *Server {
+	if c.Nodes < 1 {
+		c.Nodes = 1
+	}
+	if c.Jobs < 1 {
+		c.Jobs = 1
+	}
+	s := &Server{
+		config: c,
+		calls:  make(map[string]int),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// URL is the address of the api
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Close stops the api
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Calls returns how many calls were made to every route since the last reset
+func (s *Server) Calls() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	calls := make(map[string]int, len(s.calls))
+	for route, n := range s.calls {
+		calls[route] = n
+	}
+	return calls
+}
+
+// Reset forgets the calls made so far
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = make(map[string]int)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	route, body := s.route(r)
+
+	s.mu.Lock()
+	s.calls[route]++
+	s.mu.Unlock()
+
+	if s.config.Latency > 0 {
+		time.Sleep(s.config.Latency)
+	}
+	if body == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Nomad-Index", "1")
+	json.NewEncoder(w).Encode(body)
+}
+
+// route returns the route the request matches, with the ids replaced, and
+// the response to it, nil when there's none
+func (s *Server) route(r *http.Request) (string, interface{}) {
+	path := r.URL.Path
+	parts := strings.Split(strings.TrimPrefix(path, "/v1/"), "/")
+
+	switch {
+	case path == "/v1/status/leader":
+		return path, s.leader()
+	case path == "/v1/status/peers":
+		return path, []string{s.leader()}
+	case path == "/v1/agent/self":
+		return path, s.agentSelf()
+	case path == "/v1/agent/members":
+		return path, s.members()
+	case path == "/v1/metrics":
+		return path, map[string]interface{}{"Gauges": []interface{}{}, "Counters": []interface{}{}, "Samples": []interface{}{}}
+	case path == "/v1/operator/autopilot/health":
+		return path, api.OperatorHealthReply{Healthy: true, Servers: []api.ServerHealth{{ID: "server-1", Name: "server-1.global", Leader: true, Healthy: true}}}
+	case path == "/v1/operator/scheduler/configuration":
+		return path, api.SchedulerConfigurationResponse{SchedulerConfig: &api.SchedulerConfiguration{}}
+	case path == "/v1/nodes":
+		return path, s.nodeStubs()
+	case path == "/v1/client/stats":
+		return path, s.hostStats()
+	case path == "/v1/jobs":
+		return path, s.jobStubs()
+	case path == "/v1/allocations":
+		return path, s.allocationStubs(-1, -1)
+	case path == "/v1/evaluations":
+		return path, []*api.Evaluation{}
+	case path == "/v1/deployments":
+		return path, []*api.Deployment{}
+	case len(parts) == 2 && parts[0] == "node":
+		return "/v1/node/:id", s.node(parts[1])
+	case len(parts) == 3 && parts[0] == "node" && parts[2] == "allocations":
+		if i := s.index(parts[1], "node-"); i >= 0 {
+			return "/v1/node/:id/allocations", s.allocations(i)
+		}
+		return "/v1/node/:id/allocations", nil
+	case len(parts) == 2 && parts[0] == "job":
+		return "/v1/job/:id", s.job(parts[1])
+	case len(parts) == 3 && parts[0] == "job" && parts[2] == "allocations":
+		if j := s.index(parts[1], "job-"); j >= 0 {
+			return "/v1/job/:id/allocations", s.allocationStubs(-1, j)
+		}
+		return "/v1/job/:id/allocations", nil
+	case len(parts) == 2 && parts[0] == "allocation":
+		return "/v1/allocation/:id", s.allocation(parts[1])
+	case len(parts) == 4 && parts[0] == "client" && parts[1] == "allocation" && parts[3] == "stats":
+		return "/v1/client/allocation/:id/stats", s.allocationStats(parts[2])
+	}
+	return path, nil
+}
+
+// leader is the rpc address of the server, on the host of the api
+func (s *Server) leader() string {
+	host, _, _ := net.SplitHostPort(s.server.Listener.Addr().String())
+	return net.JoinHostPort(host, "4647")
+}
+
+// index parses the number of a generated id, -1 when it's not one
+func (s *Server) index(id, prefix string) int {
+	if !strings.HasPrefix(id, prefix) {
+		return -1
+	}
+	i, err := strconv.Atoi(strings.TrimPrefix(id, prefix))
+	if err != nil {
+		return -1
+	}
+	return i
+}
+
+func (s *Server) agentSelf() *api.AgentSelf {
+	return &api.AgentSelf{
+		Config: map[string]interface{}{"NodeName": "server-1", "Datacenter": "dc1", "Region": "global"},
+		Member: api.AgentMember{Name: "server-1.global", Addr: "127.0.0.1"},
+		Stats: map[string]map[string]string{
+			"nomad": {"server": "true"},
+			"raft":  {"applied_index": "1", "commit_index": "1", "last_log_index": "1"},
+		},
+	}
+}
+
+func (s *Server) members() *api.ServerMembers {
+	return &api.ServerMembers{
+		ServerName:   "server-1",
+		ServerRegion: "global",
+		ServerDC:     "dc1",
+		Members: []*api.AgentMember{{
+			Name:   "server-1.global",
+			Addr:   "127.0.0.1",
+			Status: "alive",
+			Tags:   map[string]string{"build": "0.9.3", "region": "global", "dc": "dc1"},
+		}},
+	}
+}
+
+func (s *Server) nodeStubs() []*api.NodeListStub {
+	nodes := make([]*api.NodeListStub, 0, s.config.Nodes)
+	for i := 0; i < s.config.Nodes; i++ {
+		nodes = append(nodes, &api.NodeListStub{
+			ID:                    fmt.Sprintf("node-%d", i),
+			Name:                  fmt.Sprintf("node-%d", i),
+			Datacenter:            "dc1",
+			Version:               "0.9.3",
+			SchedulingEligibility: "eligible",
+			Status:                "ready",
+			ModifyIndex:           1,
+		})
+	}
+	return nodes
+}
+
+func (s *Server) node(id string) *api.Node {
+	i := s.index(id, "node-")
+	if i < 0 || i >= s.config.Nodes {
+		return nil
+	}
+	return &api.Node{
+		ID:                    id,
+		Name:                  id,
+		Datacenter:            "dc1",
+		HTTPAddr:              strings.TrimPrefix(s.server.URL, "http://"),
+		Resources:             &api.Resources{CPU: intp(4000), MemoryMB: intp(8192), DiskMB: intp(100000), IOPS: intp(0)},
+		Reserved:              &api.Resources{CPU: intp(0), MemoryMB: intp(0), DiskMB: intp(0), IOPS: intp(0)},
+		SchedulingEligibility: "eligible",
+		Status:                "ready",
+		ModifyIndex:           1,
+	}
+}
+
+func (s *Server) hostStats() *api.HostStats {
+	return &api.HostStats{
+		Memory:           &api.HostMemoryStats{Total: 8 << 30, Available: 4 << 30, Used: 4 << 30, Free: 4 << 30},
+		CPU:              []*api.HostCPUStats{{CPU: "cpu0", User: 10, System: 5, Idle: 85}},
+		DiskStats:        []*api.HostDiskStats{{Device: "/dev/sda1", Mountpoint: "/", Size: 100 << 30, Used: 40 << 30}},
+		CPUTicksConsumed: 400,
+	}
+}
+
+func (s *Server) jobStubs() []*api.JobListStub {
+	jobs := make([]*api.JobListStub, 0, s.config.Jobs)
+	for j := 0; j < s.config.Jobs; j++ {
+		id := fmt.Sprintf("job-%d", j)
+		jobs = append(jobs, &api.JobListStub{
+			ID:             id,
+			Name:           id,
+			Type:           "service",
+			Status:         "running",
+			JobModifyIndex: 1,
+			JobSummary: &api.JobSummary{
+				JobID:   id,
+				Summary: map[string]api.TaskGroupSummary{"app": {Running: s.jobAllocations(j)}},
+			},
+		})
+	}
+	return jobs
+}
+
+// jobAllocations counts the allocations of job j, they are spread over the
+// jobs in turns
+func (s *Server) jobAllocations(j int) int {
+	n := s.config.Allocations / s.config.Jobs
+	if j < s.config.Allocations%s.config.Jobs {
+		n++
+	}
+	return n
+}
+
+func (s *Server) job(id string) *api.Job {
+	j := s.index(id, "job-")
+	if j < 0 || j >= s.config.Jobs {
+		return nil
+	}
+	return &api.Job{
+		ID:          stringp(id),
+		Name:        stringp(id),
+		Namespace:   stringp("default"),
+		Region:      stringp("global"),
+		Type:        stringp("service"),
+		Version:     uint64p(0),
+		Datacenters: []string{"dc1"},
+		TaskGroups: []*api.TaskGroup{{
+			Name:  stringp("app"),
+			Count: intp(s.jobAllocations(j)),
+			Tasks: []*api.Task{{
+				Name:      "app",
+				Driver:    "docker",
+				Resources: &api.Resources{CPU: intp(100), MemoryMB: intp(128)},
+			}},
+		}},
+		JobModifyIndex: uint64p(1),
+	}
+}
+
+// allocationStubs lists the allocations, of a node or a job when not -1
+func (s *Server) allocationStubs(node, job int) []*api.AllocationListStub {
+	var allocs []*api.AllocationListStub
+	for k := 0; k < s.config.Allocations; k++ {
+		if (node >= 0 && k%s.config.Nodes != node) || (job >= 0 && k%s.config.Jobs != job) {
+			continue
+		}
+		a := s.allocation(fmt.Sprintf("alloc-%d", k))
+		allocs = append(allocs, &api.AllocationListStub{
+			ID:            a.ID,
+			Namespace:     a.Namespace,
+			Name:          a.Name,
+			NodeID:        a.NodeID,
+			JobID:         a.JobID,
+			JobType:       "service",
+			TaskGroup:     a.TaskGroup,
+			DesiredStatus: a.DesiredStatus,
+			ClientStatus:  a.ClientStatus,
+			TaskStates:    a.TaskStates,
+			CreateIndex:   1,
+			ModifyIndex:   1,
+			CreateTime:    a.CreateTime,
+			ModifyTime:    a.ModifyTime,
+		})
+	}
+	return allocs
+}
+
+// allocations lists the full allocations of a node
+func (s *Server) allocations(node int) []*api.Allocation {
+	var allocs []*api.Allocation
+	for _, stub := range s.allocationStubs(node, -1) {
+		allocs = append(allocs, s.allocation(stub.ID))
+	}
+	return allocs
+}
+
+func (s *Server) allocation(id string) *api.Allocation {
+	k := s.index(id, "alloc-")
+	if k < 0 || k >= s.config.Allocations {
+		return nil
+	}
+	j := k % s.config.Jobs
+	created := time.Now().Add(-time.Hour).UnixNano()
+	return &api.Allocation{
+		ID:            id,
+		Namespace:     "default",
+		Name:          fmt.Sprintf("job-%d.app[%d]", j, k/s.config.Jobs),
+		NodeID:        fmt.Sprintf("node-%d", k%s.config.Nodes),
+		JobID:         fmt.Sprintf("job-%d", j),
+		Job:           s.job(fmt.Sprintf("job-%d", j)),
+		TaskGroup:     "app",
+		Resources:     &api.Resources{CPU: intp(100), MemoryMB: intp(128)},
+		DesiredStatus: "run",
+		ClientStatus:  "running",
+		TaskStates: map[string]*api.TaskState{
+			"app": {State: "running", StartedAt: time.Unix(0, created)},
+		},
+		CreateIndex: 1,
+		ModifyIndex: 1,
+		CreateTime:  created,
+		ModifyTime:  created,
+	}
+}
+
+func (s *Server) allocationStats(id string) *api.AllocResourceUsage {
+	if s.allocation(id) == nil {
+		return nil
+	}
+	usage := &api.ResourceUsage{
+		MemoryStats: &api.MemoryStats{RSS: 64 << 20, Cache: 16 << 20, Usage: 80 << 20, MaxUsage: 96 << 20, Measured: []string{"RSS", "Cache", "Usage", "Max Usage"}},
+		CpuStats:    &api.CpuStats{SystemMode: 1, UserMode: 2, TotalTicks: 30, Percent: 3, Measured: []string{"System Mode", "User Mode", "Percent"}},
+	}
+	return &api.AllocResourceUsage{
+		ResourceUsage: usage,
+		Tasks:         map[string]*api.TaskResourceUsage{"app": {ResourceUsage: usage}},
+	}
+}
+
+func stringp(s string) *string { return &s }
+func intp(i int) *int          { return &i }
+func uint64p(i uint64) *uint64 { return &i }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// listen listens on every address of a comma separated list, like
+// [::]:9441,127.0.0.1:9441 for dual stack. It listens on all of them before
+// serving so an address that's taken fails the start, not a later request
+func listen(spec string) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, address := range splitAddresses(spec) {
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("could not listen on %s: %s", address, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// serveListeners serves the handler on every listener, returning when any of them
+// stops serving
+func serveListeners(listeners []net.Listener, handler http.Handler) error {
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		l := l
+		go func() { errs <- http.Serve(l, handler) }()
+	}
+	return <-errs
+}
+
+// addressesOf lists the addresses of the listeners, to log them
+func addressesOf(listeners []net.Listener) string {
+	addresses := make([]string, 0, len(listeners))
+	for _, l := range listeners {
+		addresses = append(addresses, l.Addr().String())
+	}
+	return strings.Join(addresses, ", ")
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"runtime"
 	"strings"
 	"time"
 
@@ -14,12 +18,127 @@ import (
 
 	cleanhttp "github.com/hashicorp/go-cleanhttp"
 
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
 	"gitlab.com/yakshaving.art/nomad-exporter/version"
 )
 
 func main() {
-	a := parseArgs()
+	command, arguments := "serve", os.Args[1:]
+	if len(arguments) > 0 && !strings.HasPrefix(arguments[0], "-") {
+		command, arguments = arguments[0], arguments[1:]
+	}
+
+	switch command {
+	case "serve":
+		a := parseArgs(command, arguments)
+		if !runService(a, serve) {
+			serve(a)
+		}
+
+	case "probe":
+		probe(parseArgs(command, arguments))
+
+	case "check-config":
+		if err := checkConfig(parseArgs(command, arguments)); err != nil {
+			logrus.Fatalf("invalid configuration: %s", err)
+		}
+		fmt.Println("configuration is valid")
+
+	case "cardinality":
+		if err := cardinality(parseArgs(command, arguments), os.Stdout); err != nil {
+			logrus.Fatalf("could not report cardinality: %s", err)
+		}
+
+	case "alert-rules":
+		if err := runAlertRules(arguments, os.Stdout); err != nil {
+			logrus.Fatalf("could not generate alert rules: %s", err)
+		}
+
+	case "version":
+		fmt.Println(version.GetVersion())
+
+	default:
+		logrus.Fatalf("unknown command %s, expected serve, probe, check-config, cardinality, alert-rules or version", command)
+	}
+}
+
+// Probe exit codes, so a health check can tell why the cluster is down
+const (
+	probeDown         = 1
+	probeUnauthorized = 2
+	probeInvalid      = 3
+)
+
+// probe checks the configured cluster can be reached with the configured
+// token within the timeout and exits non-zero when it can't
+func probe(a args) {
+	if a.Debug {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	exporter, err := buildExporter(a)
+	if err != nil {
+		fmt.Println("DOWN")
+		logrus.Errorf("invalid configuration: %s", err)
+		os.Exit(probeInvalid)
+	}
 
+	done := make(chan error, 1)
+	go func() { done <- exporter.Probe() }()
+
+	select {
+	case err = <-done:
+	case <-time.After(time.Duration(a.ProbeTimeout) * time.Second):
+		err = fmt.Errorf("no answer within %ds", a.ProbeTimeout)
+	}
+
+	switch {
+	case err == nil:
+		fmt.Println("UP")
+	case collector.IsUnauthorized(err):
+		fmt.Println("DOWN")
+		logrus.Errorf("probe was denied: %s", err)
+		os.Exit(probeUnauthorized)
+	default:
+		fmt.Println("DOWN")
+		logrus.Errorf("probe failed: %s", err)
+		os.Exit(probeDown)
+	}
+}
+
+// checkConfig validates the arguments without talking to nomad
+func checkConfig(a args) error {
+	cfg, err := configureWith(a)
+	if err != nil {
+		return err
+	}
+	if _, err := newExporter(a, cfg); err != nil {
+		return err
+	}
+	if a.NomadTokenFile != "" {
+		if _, err := loadTokenFile(a.NomadTokenFile, &tokenTransport{}); err != nil {
+			return err
+		}
+	}
+	if a.RelabelConfigFile != "" {
+		if _, err := loadRelabelRules(a.RelabelConfigFile); err != nil {
+			return err
+		}
+	}
+	if a.AdminTokenFile != "" {
+		if _, err := loadAdminToken(a.AdminTokenFile); err != nil {
+			return err
+		}
+	}
+	if a.ElectionConsulKey != "" {
+		if _, err := newConsulElection(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func serve(a args) {
 	if a.ShowVersion {
 		fmt.Println(version.GetVersion())
 		os.Exit(0)
@@ -29,32 +148,145 @@ func main() {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 
-	apiClient, err := api.NewClient(configureWith(a))
-	if err != nil {
-		logrus.Fatalf("could not create api client: %s", err)
+	if a.Bench {
+		bench(a)
+		os.Exit(0)
 	}
 
-	exporter := &Exporter{
-		client:                        apiClient,
-		AllowStaleReads:               a.AllowStaleReads,
-		PeerMetricsEnabled:            !a.NoPeerMetricsEnabled,
-		SerfMetricsEnabled:            !a.NoSerfMetricsEnabled,
-		NodeMetricsEnabled:            !a.NoNodeMetricsEnabled,
-		JobMetricEnabled:              !a.NoJobMetricsEnabled,
-		AllocationsMetricsEnabled:     !a.NoAllocationsMetricsEnabled,
-		EvalMetricsEnabled:            !a.NoEvalMetricsEnabled,
-		DeploymentMetricsEnabled:      !a.NoDeploymentMetricsEnabled,
-		AllocationStatsMetricsEnabled: !a.NoAllocationStatsMetricsEnabled,
-		Concurrency:                   a.Concurrency,
+	exporter := mustExporter(a)
+	var notifier *webhookNotifier
+	if a.WebhookURL != "" {
+		notifier = newWebhookNotifier(a.WebhookURL, time.Duration(a.WebhookDebounce)*time.Second)
+		exporter.OnEvent = notifier.Notify
+		go notifier.run()
+	}
+	var election *consulElection
+	if a.ElectionConsulKey != "" {
+		var err error
+		if election, err = newConsulElection(a); err != nil {
+			logrus.Fatal(err)
+		}
+		exporter.Election = election
+		go election.run()
+	}
+	exporter.Start()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", rootFunc(a.MetricsPath))
+	mux.HandleFunc("/status", statusFunc(exporter, a.RequireFirstCollect))
+	configHashInfo.WithLabelValues(configHash(a.Config)).Set(1)
+	buildInfo.WithLabelValues(version.Version, version.Commit, runtime.Version()).Set(1)
+	self := []prometheus.Collector{buildInfo, configHashInfo, httpRequests, apiCalls, apiResponseBytes}
+	if !a.NoGoMetricsEnabled {
+		self = append(self, prometheus.NewGoCollector())
+	}
+	if !a.NoProcessMetricsEnabled {
+		self = append(self, prometheus.NewProcessCollector(os.Getpid(), ""))
+	}
+	var rules []*relabelRule
+	if a.RelabelConfigFile != "" {
+		var err error
+		if rules, err = loadRelabelRules(a.RelabelConfigFile); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+	if a.NomadMaxRPS > 0 {
+		self = append(self, rateLimitWait)
+	}
+	if notifier != nil {
+		self = append(self, webhookEvents)
+	}
+	if election != nil {
+		self = append(self, electionActive)
+	}
+	registry.MustRegister(self...)
+	families := familiesOf(a, exporter, registry)
+	gatherer := metricsGatherer(families, a.ClusterLabel, rules, a.SeriesLimit, exporter.Collections)
+	if a.Once {
+		mfs, err := gatherer.Gather()
+		if err != nil {
+			logrus.Errorf("could not gather all metrics: %s", err)
+		}
+		if err := writeText(os.Stdout, mfs); err != nil {
+			logrus.Fatalf("could not write metrics: %s", err)
+		}
+		if err := exporter.SaveCache(); err != nil {
+			logrus.Errorf("could not save the cache: %s", err)
+		}
+		os.Exit(0)
+	}
+	if a.PushURL != "" {
+		go runSink(newPushgatewaySink(a.PushURL, a.PushJob),
+			time.Duration(a.PushInterval)*time.Second, gatherer)
+	}
+	if a.OTLPEndpoint != "" {
+		go runSink(newOTLPSink(a.OTLPEndpoint, otlpResourceAttributes(exporter.Client(), a.ClusterLabel)),
+			time.Duration(a.OTLPInterval)*time.Second, limitedGatherer(families, rules, a.SeriesLimit, exporter.Collections))
+	}
+	if a.TextfilePath != "" {
+		go runSink(&textfileSink{path: a.TextfilePath},
+			time.Duration(a.TextfileInterval)*time.Second, gatherer)
+	}
+	if a.StatsdAddress != "" {
+		statsd, err := newStatsdSink(a.StatsdAddress)
+		if err != nil {
+			logrus.Fatalf("could not create statsd sink: %s", err)
+		}
+		go runSink(statsd, time.Duration(a.StatsdInterval)*time.Second, gatherer)
+	}
+
+	if a.RequireFirstCollect {
+		mux.Handle(a.MetricsPath, warmupHandler(exporter, gatherer))
+	} else {
+		mux.Handle(a.MetricsPath, metricsHandler(gatherer))
+	}
+
+	var token string
+	if a.AdminTokenFile != "" {
+		var err error
+		if token, err = loadAdminToken(a.AdminTokenFile); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	sockets, err := systemdListeners()
+	if err != nil {
+		logrus.Fatal(err)
 	}
-	prometheus.MustRegister(exporter)
 
-	http.HandleFunc("/", rootFunc(a.MetricsPath))
-	http.HandleFunc("/status", statusFunc(exporter))
-	http.Handle(a.MetricsPath, prometheus.Handler())
+	snapshot := exporter.Snapshot(snapshotRelabel(rules))
+	if a.AdminListenAddress == "" && len(sockets.admin) == 0 {
+		handleDebug(mux, exporter, token, a.Config, snapshot)
+	} else {
+		admin := adminMux(exporter, token, a.Config, snapshot, self...)
+		listeners := sockets.admin
+		if len(listeners) == 0 {
+			if listeners, err = listen(a.AdminListenAddress); err != nil {
+				logrus.Fatal(err)
+			}
+		}
+		go func() {
+			logrus.Println("Admin listening on", addressesOf(listeners))
+			logrus.Fatal(serveListeners(listeners, accessLog(admin, a.AccessLog)))
+		}()
+	}
 
-	logrus.Println("Listening on", a.ListenAddress)
-	logrus.Fatal(http.ListenAndServe(a.ListenAddress, nil))
+	listeners := sockets.main
+	if len(listeners) == 0 {
+		if a.ListenAddress == "" {
+			logrus.Println("Not listening, only pushing metrics")
+			notifyReady()
+			select {}
+		}
+		if listeners, err = listen(a.ListenAddress); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+	logrus.Println("Listening on", addressesOf(listeners))
+	notifyReady()
+	logrus.Fatal(serveListeners(listeners, accessLog(mux, a.AccessLog)))
 }
 
 func rootFunc(metricsPath string) func(http.ResponseWriter, *http.Request) {
@@ -69,11 +301,11 @@ func rootFunc(metricsPath string) func(http.ResponseWriter, *http.Request) {
 	}
 }
 
-func statusFunc(e *Exporter) func(http.ResponseWriter, *http.Request) {
+func statusFunc(e *collector.Exporter, requireCollect bool) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, _ *http.Request) {
 		err := e.Probe()
 		status := "UP"
-		if err != nil {
+		if err != nil || (requireCollect && !e.Collected()) {
 			status = "DOWN"
 			w.WriteHeader(http.StatusServiceUnavailable)
 		}
@@ -88,16 +320,270 @@ func statusFunc(e *Exporter) func(http.ResponseWriter, *http.Request) {
 	}
 }
 
-func configureWith(a args) *api.Config {
+// familiesOf drops the families switched off in the metrics config file,
+// and adds the corrected names of the others with -compat.legacy-names
+func familiesOf(a args, exporter prometheus.Collector, g prometheus.Gatherer) prometheus.Gatherer {
+	if a.MetricsConfigFile == "" && !a.CompatLegacyNames {
+		return g
+	}
+
+	known := knownFamilies(exporter)
+	if a.MetricsConfigFile != "" {
+		disabled, err := loadDisabledFamilies(a.MetricsConfigFile, known)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		g = familiesGatherer(g, disabled)
+	}
+	if a.CompatLegacyNames {
+		g = compatGatherer(g, known)
+	}
+	return g
+}
+
+// limitedGatherer applies the relabel rules and then the series limit to the
+// gathered metrics, collection tells the collections apart for the limit
+func limitedGatherer(g prometheus.Gatherer, rules []*relabelRule, limit int, collection func() uint64) prometheus.Gatherer {
+	if len(rules) > 0 {
+		g = relabelGatherer(g, rules)
+	}
+	if limit > 0 {
+		g = seriesLimitGatherer(g, limit, collection)
+	}
+	return g
+}
+
+func metricsGatherer(g prometheus.Gatherer, cluster string, rules []*relabelRule, limit int, collection func() uint64) prometheus.Gatherer {
+	if cluster == "" {
+		return limitedGatherer(g, rules, limit, collection)
+	}
+	return clusterLabelGatherer(limitedGatherer(g, rules, limit, collection), cluster)
+}
+
+// otlpResourceAttributes builds the OTLP resource attributes from the cluster label and
+// the region and datacenter of the agent
+func otlpResourceAttributes(c *api.Client, cluster string) map[string]string {
+	region, err := c.Agent().Region()
+	if err != nil {
+		logrus.Warnf("could not get the agent region for the OTLP resource: %s", err)
+	}
+	datacenter, err := c.Agent().Datacenter()
+	if err != nil {
+		logrus.Warnf("could not get the agent datacenter for the OTLP resource: %s", err)
+	}
+	return map[string]string{
+		"nomad.cluster":    cluster,
+		"nomad.region":     region,
+		"nomad.datacenter": datacenter,
+	}
+}
+
+// mustExporter builds the exporter and starts the token source, any failure
+// is fatal
+func mustExporter(a args) *collector.Exporter {
+	exporter, err := buildExporter(a)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return exporter
+}
+
+// buildExporter builds the exporter and starts the token source
+func buildExporter(a args) (*collector.Exporter, error) {
+	cfg, err := configureWith(a)
+	if err != nil {
+		return nil, fmt.Errorf("could not configure api client: %s", err)
+	}
+	exporter, err := newExporter(a, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not create exporter: %s", err)
+	}
+
+	if a.NomadConsulService != "" {
+		failover := cfg.HttpClient.Transport.(*failoverTransport)
+		if err := newConsulDiscovery(a).Start(failover); err != nil {
+			return nil, fmt.Errorf("could not discover nomad servers: %s", err)
+		}
+	}
+	if a.NomadSRVRecord != "" {
+		failover := cfg.HttpClient.Transport.(*failoverTransport)
+		if err := newSRVDiscovery(a).Start(failover); err != nil {
+			return nil, fmt.Errorf("could not discover nomad servers: %s", err)
+		}
+	}
+
+	switch {
+	case a.VaultNomadRole != "":
+		tokens := withTokenTransport(cfg.HttpClient)
+		vault := newVaultTokenRenewer(a.VaultAddress, a.VaultToken, a.VaultNomadMount, a.VaultNomadRole, tokens)
+		if err := vault.Start(); err != nil {
+			return nil, fmt.Errorf("could not fetch nomad token from vault: %s", err)
+		}
+
+	case a.NomadTokenFile != "":
+		tokens := withTokenTransport(cfg.HttpClient)
+		if err := watchTokenFile(a.NomadTokenFile, tokens); err != nil {
+			return nil, fmt.Errorf("could not load nomad token: %s", err)
+		}
+	}
+
+	return exporter, nil
+}
+
+// newExporter validates the arguments and creates the exporter, without
+// talking to nomad yet
+func newExporter(a args, cfg *api.Config) (*collector.Exporter, error) {
+	if a.NomadConsulService != "" && a.NomadConsulScheme != "http" && a.NomadConsulScheme != "https" {
+		return nil, fmt.Errorf("invalid consul discovery scheme %s", a.NomadConsulScheme)
+	}
+	if a.NomadSRVRecord != "" && a.NomadSRVScheme != "http" && a.NomadSRVScheme != "https" {
+		return nil, fmt.Errorf("invalid SRV discovery scheme %s", a.NomadSRVScheme)
+	}
+	if a.NomadSRVRecord != "" && a.NomadConsulService != "" {
+		return nil, fmt.Errorf("-nomad.srv-record and -nomad.consul-service can't be used together")
+	}
+	if a.VaultNomadRole != "" && a.NomadTokenFile != "" {
+		return nil, fmt.Errorf("-vault.nomad-role and -nomad.token-file can't be used together")
+	}
+	if a.Snapshot && a.AdminListenAddress == "" && a.AdminTokenFile == "" {
+		return nil, fmt.Errorf("-web.snapshot needs -web.admin-listen-address or -web.admin-token-file")
+	}
+
+	queryDefaults := collector.QueryConfig{
+		AllowStale: a.QueryStale,
+		WaitTime:   time.Duration(a.NomadWaitTime) * time.Millisecond,
+	}
+	queryOverrides, err := collector.ParseQueryOverrides(a.QueryOverrides, queryDefaults)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse query overrides: %s", err)
+	}
+	collectEvery, err := collector.ParseSchedule(a.CollectEvery)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse collect schedule: %s", err)
+	}
+	var costs *collector.CostConfig
+	if a.CostConfigFile != "" {
+		if costs, err = collector.LoadCostConfig(a.CostConfigFile); err != nil {
+			return nil, err
+		}
+	}
+
+	apiClient, err := api.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not create api client: %s", err)
+	}
+
+	opts := collector.Options{
+		Mode:                          a.Mode,
+		CollectMode:                   a.CollectMode,
+		PeerMetricsEnabled:            !a.NoPeerMetricsEnabled,
+		SerfMetricsEnabled:            !a.NoSerfMetricsEnabled,
+		NodeMetricsEnabled:            !a.NoNodeMetricsEnabled,
+		JobMetricEnabled:              !a.NoJobMetricsEnabled,
+		AllocationsMetricsEnabled:     !a.NoAllocationsMetricsEnabled,
+		EvalMetricsEnabled:            !a.NoEvalMetricsEnabled,
+		DeploymentMetricsEnabled:      !a.NoDeploymentMetricsEnabled,
+		IntegrationMetricsEnabled:     !a.NoIntegrationMetricsEnabled,
+		BrokerMetricsEnabled:          !a.NoBrokerMetricsEnabled,
+		AllocationStatsMetricsEnabled: !a.NoAllocationStatsMetricsEnabled,
+		Concurrency:                   a.Concurrency,
+		AllocationConcurrency:         a.AllocationConcurrency,
+		AllocationStatsConcurrency:    a.AllocationStatsConcurrency,
+		NamespaceConcurrency:          a.NamespaceConcurrency,
+		PageSize:                      a.PageSize,
+		CollectBudget:                 time.Duration(a.CollectBudget) * time.Second,
+		UnixSocket:                    unixSocketPath(a.NomadAddress) != "",
+		CumulativeCounters:            a.CumulativeCounters,
+		PendingThreshold:              time.Duration(a.PendingThreshold) * time.Second,
+		IncludeTerminalAllocations:    a.IncludeTerminalAllocations,
+		TerminalLookback:              time.Duration(a.TerminalLookback) * time.Second,
+		PerCPUMetrics:                 a.PerCPUMetrics,
+		AllocationPortMetrics:         a.AllocationPortMetrics,
+		KeyringMetricsEnabled:         a.KeyringMetrics,
+		PlacementMetricsEnabled:       a.PlacementMetrics,
+		PlacementMaxAge:               time.Duration(a.PlacementMaxAge) * time.Second,
+		FederationMetricsEnabled:      a.FederationMetrics,
+		FederationRegions:             a.FederationRegions,
+		Snapshot:                      a.Snapshot,
+		AllocationAggregation:         a.AllocationAggregation,
+		AllocationTopK:                a.AllocationTopK,
+		JobMetaKeys:                   a.JobMetaKeys,
+		QueryOptions:                  queryDefaults,
+		CollectorQueryOptions:         queryOverrides,
+		NodeCircuitFailures:           a.NodeCircuitFailures,
+		NodeCircuitCooldown:           time.Duration(a.NodeCircuitCooldown) * time.Second,
+		LocalStatsInterval:            time.Duration(a.LocalStatsInterval) * time.Millisecond,
+		CollectorEvery:                collectEvery,
+		CacheFile:                     a.CacheFile,
+		Costs:                         costs,
+		ClientConfig:                  cfg,
+	}
+	if failover, ok := cfg.HttpClient.Transport.(*failoverTransport); ok {
+		opts.Endpoint = failover
+	}
+	exporter, err := collector.New(apiClient, opts)
+	if err != nil {
+		return nil, err
+	}
+	if a.MetricsConfigFile != "" {
+		disabled, err := loadDisabledFamilies(a.MetricsConfigFile, knownFamilies(exporter))
+		if err != nil {
+			return nil, err
+		}
+		exporter.SkipFamilies(disabled)
+	}
+	return exporter, nil
+}
+
+// unixSocketPath returns the path of a unix:// address, empty otherwise
+func unixSocketPath(address string) string {
+	if !strings.HasPrefix(address, "unix://") {
+		return ""
+	}
+	return strings.TrimPrefix(address, "unix://")
+}
+
+func configureWith(a args) (*api.Config, error) {
 	timeout := time.Duration(a.NomadTimeout) * time.Millisecond
 	waitTime := time.Duration(a.NomadWaitTime) * time.Millisecond
 
+	addresses := splitAddresses(a.NomadAddress)
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no nomad address")
+	}
+
 	cfg := api.DefaultConfig()
-	cfg.Address = a.NomadAddress
+	cfg.Address = addresses[0]
+	if a.NomadConsulService != "" {
+		// the addresses are discovered once the exporter starts
+		addresses = nil
+		cfg.Address = fmt.Sprintf("%s://%s", a.NomadConsulScheme, a.NomadConsulService)
+	}
+	if a.NomadSRVRecord != "" {
+		// the addresses are looked up once the exporter starts
+		addresses = nil
+		cfg.Address = fmt.Sprintf("%s://%s", a.NomadSRVScheme, a.NomadSRVRecord)
+	}
 
 	httpClient := cleanhttp.DefaultClient()
 	transport := httpClient.Transport.(*http.Transport)
-	transport.TLSHandshakeTimeout = 10 * time.Second
+	if socket := unixSocketPath(cfg.Address); socket != "" {
+		if len(addresses) > 1 {
+			return nil, fmt.Errorf("a unix socket can't be used along other nomad addresses")
+		}
+
+		// the api only speaks http urls, every connection goes to the socket
+		cfg.Address = "http://localhost"
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+	}
+	transport.TLSHandshakeTimeout = time.Duration(a.NomadTLSHandshakeTimeout) * time.Millisecond
+	transport.DisableKeepAlives = !a.NomadKeepAlives
+	if a.NomadKeepAlives {
+		transport.MaxIdleConnsPerHost = a.NomadMaxIdleConnsPerHost
+	}
 	transport.TLSClientConfig = &tls.Config{
 		MinVersion: tls.VersionTLS12,
 	}
@@ -106,6 +592,10 @@ func configureWith(a args) *api.Config {
 	cfg.HttpClient = httpClient
 	cfg.WaitTime = waitTime
 
+	if a.NomadMaxRPS < 0 {
+		return nil, fmt.Errorf("invalid max requests per second %v", a.NomadMaxRPS)
+	}
+
 	if strings.HasPrefix(cfg.Address, "https://") {
 		cfg.TLSConfig.CACert = a.TLSCaFile
 		cfg.TLSConfig.CAPath = a.TLSCaPath
@@ -114,10 +604,36 @@ func configureWith(a args) *api.Config {
 		cfg.TLSConfig.Insecure = a.TLSInsecure
 		cfg.TLSConfig.TLSServerName = a.TLSServerName
 
-		if err := api.ConfigureTLS(httpClient, cfg.TLSConfig); err != nil {
-			logrus.Fatalf("failed to configure TLS: %s", err)
+		certs, err := newTLSReloader(a.TLSCaFile, a.TLSCaPath, a.TLSCert, a.TLSKey, a.TLSServerName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure TLS: %s", err)
+		}
+		certs.configure(transport, a.TLSInsecure)
+	}
+
+	if a.NomadProxyURL != "" {
+		proxy, err := url.Parse(a.NomadProxyURL)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy url %q", a.NomadProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	withAPICallsTransport(httpClient)
+	if len(a.NomadHeaders) > 0 {
+		headers, err := parseHeaders(a.NomadHeaders)
+		if err != nil {
+			return nil, err
+		}
+		withHeaderTransport(httpClient, headers)
+	}
+	if a.NomadMaxRPS > 0 {
+		withRateLimitTransport(httpClient, a.NomadMaxRPS)
+	}
+	if len(addresses) > 1 || a.NomadConsulService != "" || a.NomadSRVRecord != "" {
+		if _, err := withFailoverTransport(httpClient, addresses); err != nil {
+			return nil, err
 		}
 	}
 
-	return cfg
+	return cfg, nil
 }
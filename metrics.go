@@ -1,11 +1,7 @@
 package main
 
 import (
-	"time"
-
-	go_ver "github.com/hashicorp/go-version"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -13,386 +9,86 @@ const (
 )
 
 var (
-	up = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "up"),
-		"Wether the exporter is able to talk to the nomad server.",
-		nil, nil,
+	endpointActive = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "endpoint_active"),
+		"Wether the nomad address is the one the exporter talks to.",
+		[]string{"address"}, nil,
 	)
-	clientErrors = prometheus.NewCounter(
+	seriesLimitExceeded = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
-			Name:      "client_errors_total",
-			Help:      "Number of errors that were accounted for.",
-		})
-	clusterLeader = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "leader"),
-		"Wether the current host is the cluster leader.",
-		nil, nil)
-	clusterServers = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "raft_peers"),
-		"How many peers (servers) are in the Raft cluster.",
-		nil, nil,
-	)
-	nodeInfo = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "node_info"),
-		"Node information",
-		[]string{"class", "datacenter", "drain", "name", "node_id", "scheduling_eligibility", "status", "version"},
-		nil,
-	)
-	serfLanMembers = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "serf_lan_members"),
-		"How many members are in the cluster.",
-		nil, nil,
-	)
-	serfLanMembersStatus = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "serf_lan_member_status"),
-		"Describe member state.",
-		[]string{"class", "datacenter", "node", "node_id", "drain"}, nil,
-	)
-	raftAppliedIndex = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "raft_applied_index"),
-		"Index being applied.",
-		[]string{"datacenter", "node"}, nil,
-	)
-	raftCommitIndex = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "raft_commit_index"),
-		"Index being committed.",
-		[]string{"datacenter", "node"}, nil,
-	)
-	raftFsmPending = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "raft_fsm_pending"),
-		"Pending FSM.",
-		[]string{"datacenter", "node"}, nil,
-	)
-	raftLastLogIndex = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "raft_last_log_index"),
-		"Last log index.",
-		[]string{"datacenter", "node"}, nil,
-	)
-	raftLastSnapshotIndex = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "raft_last_snapshot_index"),
-		"Last snapshot index.",
-		[]string{"datacenter", "node"}, nil,
-	)
-	raftNumPeers = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "raft_num_peers"),
-		"Number of Raft peers.",
-		[]string{"datacenter", "node"}, nil,
-	)
-	jobsTotal = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "jobs_total"),
-		"How many jobs are there in the cluster.",
-		nil, nil,
-	)
-	allocationMemoryBytes = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "allocation_memory_rss_bytes"),
-		"Allocation memory usage",
-		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
-	)
-	allocationMemoryBytesRequired = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "allocation_memory_rss_required_bytes"),
-		"Allocation memory required.",
-		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
-	)
-	allocationCPURequired = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "allocation_cpu_required"),
-		"Allocation CPU Required.",
-		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
-	)
-	allocationCPUPercent = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "allocation_cpu_percent"),
-		"Allocation CPU usage.",
-		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
-	)
-	allocationCPUTicks = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "allocation_cpu_ticks"),
-		"Allocation CPU Ticks usage.",
-		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
-	)
-	allocationCPUUserMode = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "allocation_cpu_user_mode"),
-		"Allocation CPU User Mode Usage.",
-		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
-	)
-	allocationCPUSystemMode = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "allocation_cpu_system_mode"),
-		"Allocation CPU System Mode Usage.",
-		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
-	)
-	allocationCPUThrottled = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "allocation_cpu_throttle_time"),
-		"Allocation throttled CPU.",
-		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
-	)
-	allocationZombies = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: namespace,
-		Name:      "allocation_zombies",
-		Help:      "Allocation zombies.",
-	},
-	)
-	taskCPUTotalTicks = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "task_cpu_total_ticks"),
-		"Task CPU total ticks.",
-		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task"}, nil,
-	)
-	taskCPUPercent = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "task_cpu_percent"),
-		"Task CPU usage percent.",
-		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task"}, nil,
-	)
-	taskMemoryRssBytes = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "task_memory_rss_bytes"),
-		"Task memory RSS usage in bytes.",
-		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task"}, nil,
-	)
-
-	nodeResourceMemory = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "node_resource_memory_bytes"),
-		"Amount of allocatable memory the node has in bytes",
-		[]string{"node", "datacenter"}, nil,
-	)
-	nodeAllocatedMemory = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "node_allocated_memory_bytes"),
-		"Amount of memory allocated to tasks on the node in bytes.",
-		[]string{"node", "datacenter"}, nil,
-	)
-	nodeUsedMemory = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "node_used_memory_bytes"),
-		"Amount of memory used on the node in bytes.",
-		[]string{"node", "datacenter"}, nil,
-	)
-	nodeResourceCPU = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "node_resource_cpu_megahertz"),
-		"Amount of allocatable CPU the node has in MHz",
-		[]string{"node", "datacenter"}, nil,
-	)
-	nodeResourceIOPS = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "node_resource_iops"),
-		"Amount of allocatable IOPS the node has.",
-		[]string{"node", "datacenter"}, nil,
-	)
-	nodeResourceDiskBytes = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "node_resource_disk_bytes"),
-		"Amount of allocatable disk bytes the node has.",
-		[]string{"node", "datacenter"}, nil,
-	)
-	nodeAllocatedCPU = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "node_allocated_cpu_megahertz"),
-		"Amount of allocated CPU on the node in MHz.",
-		[]string{"node", "datacenter"}, nil,
-	)
-	nodeUsedCPU = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "node_used_cpu_megahertz"),
-		"Amount of CPU used on the node in MHz.",
-		[]string{"node", "datacenter"}, nil,
-	)
-
-	allocation = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: namespace,
-		Name:      "allocation",
-		Help:      "Allocation labeled with runtime information.",
-	},
-		[]string{
-			"status",
-			"job_type",
-			"job_id",
-			"job_version",
-			"task_group",
-			"node",
+			Subsystem: "exporter",
+			Name:      "series_limit_exceeded_total",
+			Help:      "Number of times a metric family was dropped for having more series than the limit.",
 		},
+		[]string{"family"},
 	)
-	evalCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: namespace,
-		Name:      "evals_total",
-		Help:      "The number of evaluations.",
-	},
-		[]string{"status"},
-	)
-	taskCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: namespace,
-		Name:      "tasks_total",
-		Help:      "The number of tasks.",
-	},
-		[]string{
-			"state",
-			"job_type",
-			"node",
-		},
-	)
-
-	deploymentCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: namespace,
-		Name:      "deployments_total",
-		Help:      "The number of deployments.",
-	},
-		[]string{
-			"status",
-			"job_id",
-			"job_version",
+	rateLimitWait = prometheus.NewSummary(
+		prometheus.SummaryOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "rate_limit_wait_seconds",
+			Help:      "How long requests to nomad waited for the rate limit.",
+		})
+	configHashInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "config_hash",
+			Help:      "Hash of the effective configuration of the exporter, always 1.",
 		},
+		[]string{"hash"},
 	)
-
-	deploymentTaskGroupDesiredCanaries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: namespace,
-		Name:      "deployment_task_group_desired_canaries_total",
-		Help:      "The number of desired canaries for the task group.",
-	},
-		[]string{
-			"status",
-			"job_id",
-			"job_version",
-			"task_group",
-			"promoted",
-			"auto_revert",
+	buildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "build_info",
+			Help:      "Version of the exporter, always 1.",
 		},
+		[]string{"version", "revision", "goversion"},
 	)
-
-	deploymentTaskGroupDesiredTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: namespace,
-		Name:      "deployment_task_group_desired_total",
-		Help:      "The number of desired allocs for the task group.",
-	},
-		[]string{
-			"status",
-			"job_id",
-			"job_version",
-			"task_group",
-			"promoted",
-			"auto_revert",
+	webhookEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "webhook_events_total",
+			Help:      "Number of events for the webhooks, by whether they were sent, failed, debounced or dropped.",
 		},
+		[]string{"kind", "result"},
 	)
-
-	deploymentTaskGroupPlacedAllocs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: namespace,
-		Name:      "deployment_task_group_placed_allocs_total",
-		Help:      "The number of placed allocs for the task group.",
-	},
-		[]string{
-			"status",
-			"job_id",
-			"job_version",
-			"task_group",
-			"promoted",
-			"auto_revert",
+	apiCalls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "api_calls_total",
+			Help:      "Number of requests to the nomad api, retries included.",
 		},
+		[]string{"endpoint"},
 	)
-
-	deploymentTaskGroupHealthyAllocs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: namespace,
-		Name:      "deployment_task_group_healthy_allocs_total",
-		Help:      "The number of healthy allocs for the task group.",
-	},
-		[]string{
-			"status",
-			"job_id",
-			"job_version",
-			"task_group",
-			"promoted",
-			"auto_revert",
+	apiResponseBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "api_response_bytes_total",
+			Help:      "Bytes of the responses read from the nomad api.",
 		},
+		[]string{"endpoint"},
 	)
-
-	deploymentTaskGroupUnhealthyAllocs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: namespace,
-		Name:      "deployment_task_group_unhealthy_allocs_total",
-		Help:      "the number of unhealthy allocs for the task group",
-	},
-		[]string{
-			"status",
-			"job_id",
-			"job_version",
-			"task_group",
-			"promoted",
-			"auto_revert",
+	electionActive = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "election_active",
+			Help:      "Wether this exporter holds the lock and collects the cluster metrics.",
+		})
+	httpRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "http_requests_total",
+			Help:      "Number of requests to the exporter endpoints.",
 		},
+		[]string{"handler", "code"},
 	)
-
-	apiLatencySummary = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Namespace: namespace,
-		Name:      "api_latency_seconds",
-		Help:      "nomad api latency for different queries",
-		Buckets:   prometheus.ExponentialBuckets(0.00025, 2, 12),
-	},
-		[]string{
-			"query",
-		})
-	apiNodeLatencySummary = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Namespace: namespace,
-		Name:      "api_node_latency_seconds",
-		Help:      "nomad api latency for different nodes and queries",
-		Buckets:   prometheus.ExponentialBuckets(0.00025, 2, 12),
-	},
-		[]string{
-			"node",
-			"query",
-		})
 )
-
-var minVersion *go_ver.Version
-
-func init() {
-	m, err := go_ver.NewVersion("0.8")
-	if err != nil {
-		logrus.Fatalf("failed to parse the minimum version: %s", err)
-	}
-	minVersion = m
-}
-
-func logError(err error) {
-	clientErrors.Inc()
-	logrus.Error(err)
-}
-
-func validVersion(name, ver string) bool {
-	nodeVersion, err := go_ver.NewVersion(ver)
-	if err != nil {
-		logrus.Errorf("can't parse node %s version %s: %s", name, ver, err)
-		return false
-	}
-	if nodeVersion.LessThan(minVersion) {
-		logrus.Debugf("Skipping node %s because it has version %s", name, ver)
-		return false
-	}
-	return true
-}
-
-func measure(query string, f func() error) error {
-	o := newLatencyObserver(query)
-	err := f()
-	o.observe()
-	return err
-}
-
-type latencyObserver struct {
-	startTime time.Time
-	node      string
-	query     string
-}
-
-func newLatencyObserver(query string) latencyObserver {
-	return latencyObserver{
-		node:      "",
-		query:     query,
-		startTime: time.Now(),
-	}
-}
-
-func newNodeLatencyObserver(node, query string) latencyObserver {
-	return latencyObserver{
-		node:      node,
-		query:     query,
-		startTime: time.Now(),
-	}
-}
-
-func (n latencyObserver) observe() {
-	duration := time.Since(n.startTime)
-
-	if n.node == "" {
-		apiLatencySummary.WithLabelValues(n.query).Observe(duration.Seconds())
-		logrus.Debugf("Duration for query %s: %f", n.query, duration.Seconds())
-	} else {
-		apiNodeLatencySummary.WithLabelValues(n.node, n.query).Observe(duration.Seconds())
-		logrus.Debugf("Duration for node %s, query %s: %f", n.query, n.node, duration.Seconds())
-	}
-}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
+)
+
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// metricsHandler serves the metrics in the OpenMetrics format to the scrapers
+// asking for it, and in the text format otherwise. Both are gzipped when the
+// scraper accepts it
+func metricsHandler(g prometheus.Gatherer) http.Handler {
+	text := promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsOpenMetrics(r.Header.Get("Accept")) {
+			text.ServeHTTP(w, r)
+			return
+		}
+
+		mfs, err := g.Gather()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("An error has occurred during metrics collection:\n\n%s", err), http.StatusInternalServerError)
+			return
+		}
+
+		var out io.Writer = w
+		w.Header().Set("Content-Type", openMetricsContentType)
+		if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			out = gz
+		}
+		if err := writeOpenMetrics(out, mfs); err != nil {
+			collector.LogError(fmt.Errorf("could not write metrics: %s", err))
+		}
+	})
+}
+
+func acceptsOpenMetrics(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != "application/openmetrics-text" {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func acceptsGzip(encoding string) bool {
+	for _, part := range strings.Split(encoding, ",") {
+		part = strings.TrimSpace(part)
+		if part == "gzip" || strings.HasPrefix(part, "gzip;") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeOpenMetrics writes the metric families in the OpenMetrics text
+// format. Counters without the _total suffix OpenMetrics asks for are typed
+// unknown rather than renamed
+func writeOpenMetrics(w io.Writer, mfs []*dto.MetricFamily) error {
+	b := bufio.NewWriter(w)
+	for _, mf := range mfs {
+		name, typ := mf.GetName(), "unknown"
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			if strings.HasSuffix(name, "_total") {
+				name, typ = strings.TrimSuffix(name, "_total"), "counter"
+			}
+		case dto.MetricType_GAUGE:
+			typ = "gauge"
+		case dto.MetricType_SUMMARY:
+			typ = "summary"
+		case dto.MetricType_HISTOGRAM:
+			typ = "histogram"
+		}
+
+		fmt.Fprintf(b, "# TYPE %s %s\n", name, typ)
+		if mf.Help != nil {
+			fmt.Fprintf(b, "# HELP %s %s\n", name, escapeOpenMetrics(mf.GetHelp()))
+		}
+		for _, m := range mf.Metric {
+			writeOpenMetricsSamples(b, mf.GetName(), mf.GetType(), m)
+		}
+	}
+	b.WriteString("# EOF\n")
+	return b.Flush()
+}
+
+func writeOpenMetricsSamples(b *bufio.Writer, name string, typ dto.MetricType, m *dto.Metric) {
+	sample := func(suffix string, value float64, extra ...string) {
+		b.WriteString(name + suffix)
+		writeOpenMetricsLabels(b, m.Label, extra...)
+		b.WriteString(" " + formatOpenMetricsFloat(value))
+		if m.TimestampMs != nil {
+			b.WriteString(" " + strconv.FormatFloat(float64(m.GetTimestampMs())/1000, 'f', -1, 64))
+		}
+		b.WriteString("\n")
+	}
+
+	switch typ {
+	case dto.MetricType_COUNTER:
+		sample("", m.GetCounter().GetValue())
+	case dto.MetricType_GAUGE:
+		sample("", m.GetGauge().GetValue())
+	case dto.MetricType_SUMMARY:
+		s := m.GetSummary()
+		for _, q := range s.Quantile {
+			sample("", q.GetValue(), "quantile", formatOpenMetricsFloat(q.GetQuantile()))
+		}
+		sample("_sum", s.GetSampleSum())
+		sample("_count", float64(s.GetSampleCount()))
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		var inf bool
+		for _, bucket := range h.Bucket {
+			inf = inf || math.IsInf(bucket.GetUpperBound(), 1)
+			sample("_bucket", float64(bucket.GetCumulativeCount()), "le", formatOpenMetricsFloat(bucket.GetUpperBound()))
+		}
+		if !inf {
+			sample("_bucket", float64(h.GetSampleCount()), "le", "+Inf")
+		}
+		sample("_sum", h.GetSampleSum())
+		sample("_count", float64(h.GetSampleCount()))
+	default:
+		sample("", m.GetUntyped().GetValue())
+	}
+}
+
+// writeOpenMetricsLabels writes the labels of a sample sorted by name, with
+// the extra name and value pairs of the sample at the end
+func writeOpenMetricsLabels(b *bufio.Writer, labels []*dto.LabelPair, extra ...string) {
+	if len(labels) == 0 && len(extra) == 0 {
+		return
+	}
+	sorted := append([]*dto.LabelPair{}, labels...)
+	sort.Sort(labelPairSorter(sorted))
+
+	pairs := make([]string, 0, len(sorted)+len(extra)/2)
+	for _, l := range sorted {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l.GetName(), escapeOpenMetrics(l.GetValue())))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], extra[i+1]))
+	}
+	b.WriteString("{" + strings.Join(pairs, ",") + "}")
+}
+
+var openMetricsEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeOpenMetrics(s string) string {
+	return openMetricsEscaper.Replace(s)
+}
+
+func formatOpenMetricsFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
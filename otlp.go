@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/version"
+)
+
+// OTLP aggregation temporality for cumulative values
+const otlpCumulative = 2
+
+// otlpSink converts the metrics to OTLP and pushes them to an OpenTelemetry
+// collector using the OTLP/HTTP JSON encoding
+type otlpSink struct {
+	endpoint string
+	client   *http.Client
+	resource []otlpKeyValue
+}
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+	Summary     *otlpSummary   `json:"summary,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	TimeUnixNano string         `json:"timeUnixNano"`
+	AsDouble     otlpDouble     `json:"asDouble"`
+}
+
+type otlpHistogram struct {
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes     []otlpKeyValue `json:"attributes,omitempty"`
+	TimeUnixNano   string         `json:"timeUnixNano"`
+	Count          string         `json:"count"`
+	Sum            otlpDouble     `json:"sum"`
+	BucketCounts   []string       `json:"bucketCounts"`
+	ExplicitBounds []otlpDouble   `json:"explicitBounds"`
+}
+
+type otlpSummary struct {
+	DataPoints []otlpSummaryDataPoint `json:"dataPoints"`
+}
+
+type otlpSummaryDataPoint struct {
+	Attributes     []otlpKeyValue      `json:"attributes,omitempty"`
+	TimeUnixNano   string              `json:"timeUnixNano"`
+	Count          string              `json:"count"`
+	Sum            otlpDouble          `json:"sum"`
+	QuantileValues []otlpQuantileValue `json:"quantileValues"`
+}
+
+type otlpQuantileValue struct {
+	Quantile otlpDouble `json:"quantile"`
+	Value    otlpDouble `json:"value"`
+}
+
+// otlpDouble encodes NaN and infinities as strings, as the protobuf JSON
+// mapping does
+type otlpDouble float64
+
+func (d otlpDouble) MarshalJSON() ([]byte, error) {
+	f := float64(d)
+	switch {
+	case math.IsNaN(f):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(f, 1):
+		return []byte(`"Infinity"`), nil
+	case math.IsInf(f, -1):
+		return []byte(`"-Infinity"`), nil
+	}
+	return json.Marshal(f)
+}
+
+func newOTLPSink(endpoint string, resource map[string]string) *otlpSink {
+	attributes := []otlpKeyValue{otlpAttribute("service.name", "nomad-exporter")}
+	keys := make([]string, 0, len(resource))
+	for k := range resource {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if resource[k] != "" {
+			attributes = append(attributes, otlpAttribute(k, resource[k]))
+		}
+	}
+
+	return &otlpSink{
+		endpoint: endpoint,
+		client:   cleanhttp.DefaultClient(),
+		resource: attributes,
+	}
+}
+
+func (o *otlpSink) String() string {
+	return fmt.Sprintf("otlp %s", o.endpoint)
+}
+
+// Push implements sink
+func (o *otlpSink) Push(mfs []*dto.MetricFamily) error {
+	body, err := json.Marshal(otlpRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{Attributes: o.resource},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: "nomad-exporter", Version: version.Version},
+				Metrics: otlpMetrics(mfs, time.Now()),
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := o.client.Post(o.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func otlpMetrics(mfs []*dto.MetricFamily, now time.Time) []otlpMetric {
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+
+	metrics := make([]otlpMetric, 0, len(mfs))
+	for _, mf := range mfs {
+		m := otlpMetric{
+			Name:        mf.GetName(),
+			Description: mf.GetHelp(),
+		}
+
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			m.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+			for _, metric := range mf.Metric {
+				m.Sum.DataPoints = append(m.Sum.DataPoints, otlpNumberDataPoint{
+					Attributes:   otlpLabels(metric.Label),
+					TimeUnixNano: ts,
+					AsDouble:     otlpDouble(metric.GetCounter().GetValue()),
+				})
+			}
+
+		case dto.MetricType_HISTOGRAM:
+			m.Histogram = &otlpHistogram{AggregationTemporality: otlpCumulative}
+			for _, metric := range mf.Metric {
+				m.Histogram.DataPoints = append(m.Histogram.DataPoints, otlpHistogramPoint(metric, ts))
+			}
+
+		case dto.MetricType_SUMMARY:
+			m.Summary = &otlpSummary{}
+			for _, metric := range mf.Metric {
+				s := metric.GetSummary()
+				p := otlpSummaryDataPoint{
+					Attributes:   otlpLabels(metric.Label),
+					TimeUnixNano: ts,
+					Count:        strconv.FormatUint(s.GetSampleCount(), 10),
+					Sum:          otlpDouble(s.GetSampleSum()),
+				}
+				for _, q := range s.Quantile {
+					p.QuantileValues = append(p.QuantileValues, otlpQuantileValue{
+						Quantile: otlpDouble(q.GetQuantile()),
+						Value:    otlpDouble(q.GetValue()),
+					})
+				}
+				m.Summary.DataPoints = append(m.Summary.DataPoints, p)
+			}
+
+		default:
+			m.Gauge = &otlpGauge{}
+			for _, metric := range mf.Metric {
+				value := metric.GetGauge().GetValue()
+				if mf.GetType() == dto.MetricType_UNTYPED {
+					value = metric.GetUntyped().GetValue()
+				}
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, otlpNumberDataPoint{
+					Attributes:   otlpLabels(metric.Label),
+					TimeUnixNano: ts,
+					AsDouble:     otlpDouble(value),
+				})
+			}
+		}
+
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// otlpHistogramPoint converts the prometheus cumulative buckets into the
+// per bucket counts OTLP expects
+func otlpHistogramPoint(metric *dto.Metric, ts string) otlpHistogramDataPoint {
+	h := metric.GetHistogram()
+	p := otlpHistogramDataPoint{
+		Attributes:   otlpLabels(metric.Label),
+		TimeUnixNano: ts,
+		Count:        strconv.FormatUint(h.GetSampleCount(), 10),
+		Sum:          otlpDouble(h.GetSampleSum()),
+	}
+
+	var previous uint64
+	for _, b := range h.Bucket {
+		p.ExplicitBounds = append(p.ExplicitBounds, otlpDouble(b.GetUpperBound()))
+		p.BucketCounts = append(p.BucketCounts, strconv.FormatUint(b.GetCumulativeCount()-previous, 10))
+		previous = b.GetCumulativeCount()
+	}
+	p.BucketCounts = append(p.BucketCounts, strconv.FormatUint(h.GetSampleCount()-previous, 10))
+	return p
+}
+
+func otlpLabels(labels []*dto.LabelPair) []otlpKeyValue {
+	attributes := make([]otlpKeyValue, 0, len(labels))
+	for _, l := range labels {
+		attributes = append(attributes, otlpAttribute(l.GetName(), l.GetValue()))
+	}
+	return attributes
+}
+
+func otlpAttribute(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpValue{StringValue: value}}
+}
@@ -0,0 +1,211 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Allocation stats aggregation levels
+const (
+	AggregationAlloc = "alloc"
+	AggregationJob   = "job"
+	AggregationTopK  = "topk"
+)
+
+func validAggregation(aggregation string) bool {
+	switch aggregation {
+	case AggregationAlloc, AggregationJob, AggregationTopK:
+		return true
+	}
+	return false
+}
+
+type groupUsageKey struct {
+	job, group, region, datacenter string
+}
+
+// groupUsage is the resource usage of the running allocations of a task group
+type groupUsage struct {
+	allocations    int
+	cpuPercent     float64
+	memoryRSS      float64
+	memoryRequired float64
+	cpuRequired    float64
+	memoryStats    map[string]float64
+}
+
+// groupUsages sums the stats of the allocations of a scrape per job and task
+// group, so short lived allocations don't create a series each. Cumulative
+// cpu values are left out as their sum goes back when allocations stop
+type groupUsages struct {
+	mu    sync.Mutex
+	usage map[groupUsageKey]*groupUsage
+}
+
+func newGroupUsages() *groupUsages {
+	return &groupUsages{
+		usage: make(map[groupUsageKey]*groupUsage),
+	}
+}
+
+func (g *groupUsages) add(alloc *api.Allocation, datacenter string, stats *api.AllocResourceUsage) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := groupUsageKey{*alloc.Job.Name, alloc.TaskGroup, *alloc.Job.Region, datacenter}
+	u, ok := g.usage[key]
+	if !ok {
+		u = &groupUsage{memoryStats: make(map[string]float64)}
+		g.usage[key] = u
+	}
+
+	u.allocations++
+	u.cpuPercent += stats.ResourceUsage.CpuStats.Percent
+	u.memoryRSS += float64(stats.ResourceUsage.MemoryStats.RSS)
+	u.memoryRequired += float64(*alloc.Resources.MemoryMB) * 1024 * 1024
+	u.cpuRequired += float64(*alloc.Resources.CPU)
+	for stat, value := range memoryStats(stats.ResourceUsage.MemoryStats) {
+		u.memoryStats[stat] += value
+	}
+}
+
+func (g *groupUsages) collect(ch chan<- prometheus.Metric) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for key, u := range g.usage {
+		labels := []string{key.job, key.group, key.region, key.datacenter}
+		ch <- prometheus.MustNewConstMetric(
+			groupAllocations, prometheus.GaugeValue, float64(u.allocations), labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			groupCPUPercent, prometheus.GaugeValue, u.cpuPercent, labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			groupMemoryBytes, prometheus.GaugeValue, u.memoryRSS, labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			groupMemoryBytesRequired, prometheus.GaugeValue, u.memoryRequired, labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			groupCPURequired, prometheus.GaugeValue, u.cpuRequired, labels...,
+		)
+		for stat, value := range u.memoryStats {
+			ch <- prometheus.MustNewConstMetric(
+				groupMemoryStatBytes, prometheus.GaugeValue, value, append(labels, stat)...,
+			)
+		}
+	}
+}
+
+// aggregateAllocationStats adds the resource usage of a running allocation
+// to the usage of its task group
+func (e *Exporter) aggregateAllocationStats(usages *groupUsages, alloc *api.Allocation, datacenter, nodeName string) error {
+	stats, err := e.allocationStats(nodeName, alloc)
+	if err != nil {
+		return fmt.Errorf("could not get allocation %s stats: %s", alloc.ID, err)
+	}
+	usages.add(alloc, datacenter, stats)
+	return nil
+}
+
+// allocationUsage is the stats of a running allocation
+type allocationUsage struct {
+	alloc      *api.Allocation
+	datacenter string
+	stats      *api.AllocResourceUsage
+}
+
+// topAllocations keeps the stats of the running allocations of a scrape per
+// node, so only the ones using the most cpu or memory on every node get
+// their own series and the rest is summed up
+type topAllocations struct {
+	k int
+
+	mu    sync.Mutex
+	nodes map[string][]allocationUsage
+}
+
+func newTopAllocations(k int) *topAllocations {
+	return &topAllocations{
+		k:     k,
+		nodes: make(map[string][]allocationUsage),
+	}
+}
+
+func (t *topAllocations) add(nodeName string, usage allocationUsage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nodes[nodeName] = append(t.nodes[nodeName], usage)
+}
+
+// split returns the k allocations of the node using the most cpu along with
+// the k using the most memory, and the others
+func (t *topAllocations) split(usages []allocationUsage) (top, others []allocationUsage) {
+	picked := make(map[string]bool)
+	for _, less := range []func(a, b *api.ResourceUsage) bool{
+		func(a, b *api.ResourceUsage) bool { return a.CpuStats.Percent > b.CpuStats.Percent },
+		func(a, b *api.ResourceUsage) bool { return a.MemoryStats.RSS > b.MemoryStats.RSS },
+	} {
+		sort.SliceStable(usages, func(i, j int) bool {
+			return less(usages[i].stats.ResourceUsage, usages[j].stats.ResourceUsage)
+		})
+		for i := 0; i < len(usages) && i < t.k; i++ {
+			picked[usages[i].alloc.ID] = true
+		}
+	}
+
+	for _, u := range usages {
+		if picked[u.alloc.ID] {
+			top = append(top, u)
+		} else {
+			others = append(others, u)
+		}
+	}
+	return top, others
+}
+
+// rankAllocationStats keeps the resource usage of a running allocation to
+// rank it against the others of its node
+func (e *Exporter) rankAllocationStats(top *topAllocations, alloc *api.Allocation, datacenter, nodeName string) error {
+	stats, err := e.allocationStats(nodeName, alloc)
+	if err != nil {
+		return fmt.Errorf("could not get allocation %s stats: %s", alloc.ID, err)
+	}
+	top.add(nodeName, allocationUsage{alloc, datacenter, stats})
+	return nil
+}
+
+// collectTopAllocations exports the stats of the top allocations of every
+// node, and the sum of the others
+func (e *Exporter) collectTopAllocations(top *topAllocations, ch chan<- prometheus.Metric) {
+	top.mu.Lock()
+	defer top.mu.Unlock()
+
+	for nodeName, usages := range top.nodes {
+		ranked, others := top.split(usages)
+		for _, u := range ranked {
+			e.exportAllocationStats(u.alloc, u.stats, u.datacenter, nodeName, ch)
+		}
+
+		var cpuPercent, memoryRSS float64
+		for _, u := range others {
+			cpuPercent += u.stats.ResourceUsage.CpuStats.Percent
+			memoryRSS += float64(u.stats.ResourceUsage.MemoryStats.RSS)
+		}
+		labels := []string{nodeName, usages[0].datacenter}
+		ch <- prometheus.MustNewConstMetric(
+			nodeOtherAllocations, prometheus.GaugeValue, float64(len(others)), labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			nodeOtherAllocationsCPUPercent, prometheus.GaugeValue, cpuPercent, labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			nodeOtherAllocationsMemoryBytes, prometheus.GaugeValue, memoryRSS, labels...,
+		)
+	}
+}
@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/sirupsen/logrus"
+)
+
+// allocatedTotals is the cpu and memory allocated to the running allocations
+// of a node, and to those of every job on it. memoryMaxMB is the memory the
+// allocations may use when the node oversubscribes it, memoryMB otherwise
+type allocatedTotals struct {
+	cpu         int
+	memoryMB    int
+	memoryMaxMB int
+	jobs        map[allocatedJob]allocatedTotals
+}
+
+type allocatedJob struct {
+	namespace, id string
+}
+
+// add adds the resources of a running allocation of the job
+func (t *allocatedTotals) add(namespace, jobID string, cpu, memoryMB, memoryMaxMB int) {
+	if memoryMaxMB < memoryMB {
+		memoryMaxMB = memoryMB
+	}
+	t.cpu += cpu
+	t.memoryMB += memoryMB
+	t.memoryMaxMB += memoryMaxMB
+
+	if t.jobs == nil {
+		t.jobs = make(map[allocatedJob]allocatedTotals)
+	}
+	job := allocatedJob{namespace, jobID}
+	j := t.jobs[job]
+	j.cpu += cpu
+	j.memoryMB += memoryMB
+	j.memoryMaxMB += memoryMaxMB
+	t.jobs[job] = j
+}
+
+// nodeAllocated is the resources allocated on every node, by node id
+type nodeAllocated map[string]allocatedTotals
+
+// allocatedStub is the part of an allocation stub the allocated resources
+// are read from
+type allocatedStub struct {
+	Namespace          string
+	JobID              string
+	NodeID             string
+	ClientStatus       string
+	AllocatedResources *allocatedStubResources
+}
+
+// allocatedStubResources are the resources of the tasks of an allocation
+// stub, decoded apart from the api ones as they lack the memory max
+type allocatedStubResources struct {
+	Tasks map[string]*struct {
+		Cpu struct {
+			CpuShares int64
+		}
+		Memory struct {
+			MemoryMB    int64
+			MemoryMaxMB int64
+		}
+	}
+}
+
+// listAllocated sums the resources allocated on every node from a single list
+// of the allocations of the cluster, rather than listing the allocations of
+// every node. It returns nil when the servers don't return the resources of
+// the stubs, the resources parameter needs a recent nomad, and the
+// allocations are then listed node by node
+func (e *Exporter) listAllocated() (nodeAllocated, error) {
+	var mu sync.Mutex
+	var stubs []*allocatedStub
+	err := e.listNamespaced("allocations", func(namespace string, q *api.QueryOptions) error {
+		if namespace == "" {
+			q.Namespace = "*"
+		}
+		var list []*allocatedStub
+		if err := e.queryPages("/v1/allocations?resources=true&task_states=false", &list, q); err != nil {
+			return err
+		}
+		mu.Lock()
+		stubs = append(stubs, list...)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not get allocated resources: %s", err)
+	}
+
+	allocated := make(nodeAllocated)
+	for _, stub := range stubs {
+		if stub.ClientStatus != "running" {
+			continue
+		}
+		if stub.AllocatedResources == nil {
+			logrus.Debugf("The allocations list has no resources, listing the allocations node by node")
+			return nil, nil
+		}
+
+		totals := allocated[stub.NodeID]
+		for _, task := range stub.AllocatedResources.Tasks {
+			if task == nil {
+				continue
+			}
+			totals.add(stub.Namespace, stub.JobID, int(task.Cpu.CpuShares), int(task.Memory.MemoryMB), int(task.Memory.MemoryMaxMB))
+		}
+		allocated[stub.NodeID] = totals
+	}
+	return allocated, nil
+}
+
+// nodeAllocatedTotals returns the resources allocated on the node, from the
+// cluster list when there's one, listing the allocations of the node
+// otherwise
+func (e *Exporter) nodeAllocatedTotals(n *api.Node, allocated nodeAllocated) (allocatedTotals, error) {
+	if allocated != nil {
+		return allocated[n.ID], nil
+	}
+
+	o := newNodeLatencyObserver(n.Name, "get_running_allocs")
+	runningAllocs, err := e.getRunningAllocs(n.ID)
+	o.observe()
+	if err != nil {
+		return allocatedTotals{}, fmt.Errorf("failed to get node %s running allocs: %s", n.Name, err)
+	}
+
+	// the node allocations don't tell the memory max, nomad only returns it
+	// along the resources of the allocations list
+	var totals allocatedTotals
+	for _, alloc := range runningAllocs {
+		totals.add(alloc.Namespace, alloc.JobID, *alloc.Resources.CPU, *alloc.Resources.MemoryMB, *alloc.Resources.MemoryMB)
+	}
+	return totals, nil
+}
@@ -0,0 +1,146 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+type jobVersionKey struct {
+	namespace, id string
+	version       uint64
+}
+
+// allocationJobs keeps the job of every job version seen in an allocation.
+// The allocation list stub has everything the collectors need but the job,
+// which is the same for all the allocations of a job version, so the
+// allocations are only fetched when their job version isn't known yet. The
+// lifecycle of the tasks is kept apart as the api job lacks it
+type allocationJobs struct {
+	mu         sync.Mutex
+	jobs       map[jobVersionKey]*api.Job
+	lifecycles map[jobVersionKey]taskLifecycles
+	seen       map[jobVersionKey]bool
+}
+
+func newAllocationJobs() *allocationJobs {
+	return &allocationJobs{
+		jobs:       make(map[jobVersionKey]*api.Job),
+		lifecycles: make(map[jobVersionKey]taskLifecycles),
+		seen:       make(map[jobVersionKey]bool),
+	}
+}
+
+func (a *allocationJobs) get(key jobVersionKey) (*api.Job, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.seen[key] = true
+	job, ok := a.jobs[key]
+	return job, ok
+}
+
+func (a *allocationJobs) put(key jobVersionKey, job *api.Job) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.jobs[key] = job
+}
+
+func (a *allocationJobs) putLifecycles(key jobVersionKey, lifecycles taskLifecycles) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.seen[key] = true
+	a.lifecycles[key] = lifecycles
+}
+
+func (a *allocationJobs) getLifecycles(key jobVersionKey) taskLifecycles {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.lifecycles[key]
+}
+
+// prune forgets the job versions without allocations since the last prune
+func (a *allocationJobs) prune() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for key := range a.jobs {
+		if !a.seen[key] {
+			delete(a.jobs, key)
+		}
+	}
+	for key := range a.lifecycles {
+		if !a.seen[key] {
+			delete(a.lifecycles, key)
+		}
+	}
+	a.seen = make(map[jobVersionKey]bool)
+}
+
+// allocationInfo returns the allocation built from the list stub and the
+// known job of its version. The allocation is only fetched when the job
+// version is new, or when the allocated ports are needed as the stub lacks
+// them
+func (e *Exporter) allocationInfo(stub api.AllocationListStub) (*api.Allocation, error) {
+	key := jobVersionKey{stub.Namespace, stub.JobID, stub.JobVersion}
+	job, ok := e.allocationJobs.get(key)
+	if ok && !(e.AllocationPortMetrics && stub.ClientStatus == "running") {
+		return &api.Allocation{
+			ID:            stub.ID,
+			Namespace:     stub.Namespace,
+			EvalID:        stub.EvalID,
+			Name:          stub.Name,
+			NodeID:        stub.NodeID,
+			JobID:         stub.JobID,
+			Job:           job,
+			TaskGroup:     stub.TaskGroup,
+			Resources:     taskGroupResources(job, stub.TaskGroup),
+			DesiredStatus: stub.DesiredStatus,
+			ClientStatus:  stub.ClientStatus,
+			TaskStates:    stub.TaskStates,
+			CreateIndex:   stub.CreateIndex,
+			ModifyIndex:   stub.ModifyIndex,
+			CreateTime:    stub.CreateTime,
+			ModifyTime:    stub.ModifyTime,
+		}, nil
+	}
+
+	o := newLatencyObserver("get_allocation_info")
+	var alloc *api.Allocation
+	err := e.queryAllocations("/v1/allocation/"+stub.ID, &alloc, e.queryOptions("allocations"))
+	o.observe()
+	if err != nil {
+		return nil, fmt.Errorf("could not get allocation %s: %s", stub.ID, err)
+	}
+	if alloc.Job != nil {
+		e.allocationJobs.put(key, alloc.Job)
+	}
+	return alloc, nil
+}
+
+// taskGroupResources adds up the cpu and memory its tasks ask for, as nomad
+// does for the allocation resources
+func taskGroupResources(job *api.Job, group string) *api.Resources {
+	var cpu, memoryMB int
+	for _, tg := range job.TaskGroups {
+		if tg.Name == nil || *tg.Name != group {
+			continue
+		}
+		for _, task := range tg.Tasks {
+			if task.Resources == nil {
+				continue
+			}
+			if task.Resources.CPU != nil {
+				cpu += *task.Resources.CPU
+			}
+			if task.Resources.MemoryMB != nil {
+				memoryMB += *task.Resources.MemoryMB
+			}
+		}
+	}
+	return &api.Resources{CPU: &cpu, MemoryMB: &memoryMB}
+}
@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/sirupsen/logrus"
+)
+
+// localAllocStats keeps the last stats of the allocations running on the
+// local nomad client, refreshed in the background so scrapes don't have to
+// wait for the stats calls. They're polled as the client stats endpoints
+// don't stream
+type localAllocStats struct {
+	client   *api.Client
+	interval time.Duration
+
+	mu     sync.RWMutex
+	nodeID string
+	stats  map[string]*api.AllocResourceUsage
+}
+
+func newLocalAllocStats(client *api.Client, interval time.Duration) *localAllocStats {
+	return &localAllocStats{
+		client:   client,
+		interval: interval,
+		stats:    make(map[string]*api.AllocResourceUsage),
+	}
+}
+
+// Start polls the local client stats in the background
+func (l *localAllocStats) Start() {
+	go func() {
+		for {
+			if err := l.refresh(); err != nil {
+				LogError(err)
+			}
+			time.Sleep(l.interval)
+		}
+	}()
+}
+
+// Get returns the cached stats for the allocation if it runs on the local node
+func (l *localAllocStats) Get(nodeID, allocID string) (*api.AllocResourceUsage, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if nodeID != l.nodeID {
+		return nil, false
+	}
+	s, ok := l.stats[allocID]
+	return s, ok
+}
+
+func (l *localAllocStats) refresh() error {
+	nodeID, err := l.localNodeID()
+	if err != nil {
+		return err
+	}
+
+	o := newNodeLatencyObserver(nodeID, "local_allocations")
+	allocs, _, err := l.client.Nodes().Allocations(nodeID, &api.QueryOptions{AllowStale: true})
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("could not get local allocations: %s", err)
+	}
+
+	stats := make(map[string]*api.AllocResourceUsage)
+	for _, alloc := range allocs {
+		if alloc.ClientStatus != "running" {
+			continue
+		}
+		o := newNodeLatencyObserver(nodeID, "local_allocation_stats")
+		s, err := l.client.Allocations().Stats(alloc, nil)
+		o.observe()
+		if err != nil {
+			LogError(fmt.Errorf("could not get local allocation %s stats: %s", alloc.ID, err))
+			continue
+		}
+		stats[alloc.ID] = s
+	}
+	logrus.Debugf("Refreshed stats for %d local allocations", len(stats))
+
+	l.mu.Lock()
+	l.nodeID = nodeID
+	l.stats = stats
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *localAllocStats) localNodeID() (string, error) {
+	l.mu.RLock()
+	nodeID := l.nodeID
+	l.mu.RUnlock()
+	if nodeID != "" {
+		return nodeID, nil
+	}
+
+	self, err := l.client.Agent().Self()
+	if err != nil {
+		return "", fmt.Errorf("could not get local agent: %s", err)
+	}
+	nodeID = self.Stats["client"]["node_id"]
+	if nodeID == "" {
+		return "", fmt.Errorf("local agent is not a nomad client, can't cache allocation stats")
+	}
+	return nodeID, nil
+}
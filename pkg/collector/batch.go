@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// batchCompletions remembers the completed allocations of the batch jobs
+// between collections, the job summaries have no timestamps so the
+// allocations of a job are only listed when its completed count changes
+type batchCompletions struct {
+	mu       sync.Mutex
+	complete map[string]int
+	last     map[string]time.Time
+}
+
+func newBatchCompletions() *batchCompletions {
+	return &batchCompletions{
+		complete: make(map[string]int),
+		last:     make(map[string]time.Time),
+	}
+}
+
+// batchJobCounts are the allocation counts of a batch job and its children
+type batchJobCounts struct {
+	id, namespace             string
+	complete, failed, running int
+}
+
+// collectBatchJobs exports the allocation counts of the batch jobs and when
+// they last completed an allocation. Children of periodic and parameterized
+// jobs are accounted to their parent
+func (e *Exporter) collectBatchJobs(jobs []*jobListStub, ch chan<- prometheus.Metric) {
+	b := e.batchCompletions
+	b.mu.Lock()
+	previous := b.complete
+	b.mu.Unlock()
+
+	counts := make(map[string]*batchJobCounts)
+	complete := make(map[string]int)
+	last := make(map[string]time.Time)
+	for _, job := range jobs {
+		if job.Type != "batch" || job.JobSummary == nil {
+			continue
+		}
+
+		id := job.ID
+		if job.ParentID != "" {
+			id = job.ParentID
+		}
+		parent := jobKey(job.Namespace, id)
+		c, ok := counts[parent]
+		if !ok {
+			c = &batchJobCounts{id: id, namespace: job.Namespace}
+			counts[parent] = c
+		}
+
+		var jobComplete int
+		for _, tg := range job.JobSummary.Summary {
+			jobComplete += tg.Complete
+			c.failed += tg.Failed
+			c.running += tg.Running
+		}
+		c.complete += jobComplete
+		key := jobKey(job.Namespace, job.ID)
+		complete[key] = jobComplete
+
+		if jobComplete == 0 || jobComplete == previous[key] {
+			continue
+		}
+		t, err := e.lastCompleteTime(job.Namespace, job.ID)
+		if err != nil {
+			LogError(err)
+			delete(complete, key)
+			continue
+		}
+		if t.After(last[parent]) {
+			last[parent] = t
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.complete = complete
+	for key, t := range last {
+		if t.After(b.last[key]) {
+			b.last[key] = t
+		}
+	}
+	for key := range b.last {
+		if _, ok := counts[key]; !ok {
+			delete(b.last, key)
+		}
+	}
+
+	for key, c := range counts {
+		ch <- prometheus.MustNewConstMetric(
+			jobBatchAllocations, prometheus.GaugeValue, float64(c.complete), c.id, c.namespace, "complete")
+		ch <- prometheus.MustNewConstMetric(
+			jobBatchAllocations, prometheus.GaugeValue, float64(c.failed), c.id, c.namespace, "failed")
+		ch <- prometheus.MustNewConstMetric(
+			jobBatchAllocations, prometheus.GaugeValue, float64(c.running), c.id, c.namespace, "running")
+
+		if t, ok := b.last[key]; ok {
+			ch <- prometheus.MustNewConstMetric(
+				jobBatchLastComplete, prometheus.GaugeValue, float64(t.Unix()), c.id, c.namespace)
+		}
+	}
+}
+
+// lastCompleteTime returns when the last completed allocation of the job
+// finished
+func (e *Exporter) lastCompleteTime(namespace, jobID string) (time.Time, error) {
+	q := e.queryOptions("jobs")
+	q.Namespace = namespace
+	o := newLatencyObserver("get_job_allocations")
+	allocs, _, err := e.client.Jobs().Allocations(url.PathEscape(jobID), false, q)
+	o.observe()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not get allocations of batch job %s of namespace %s: %s", jobID, namespace, err)
+	}
+
+	var last time.Time
+	for _, alloc := range allocs {
+		if alloc.ClientStatus != "complete" {
+			continue
+		}
+		if t := time.Unix(0, alloc.ModifyTime); t.After(last) {
+			last = t
+		}
+	}
+	return last, nil
+}
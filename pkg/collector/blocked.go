@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// exhaustedDimension is the resource a dimension nomad reports exhausted
+// nodes on is about, the ports and devices dimensions name the conflict
+func exhaustedDimension(dimension string) string {
+	switch {
+	case strings.Contains(dimension, "port"):
+		return "ports"
+	case strings.Contains(dimension, "bandwidth"):
+		return "bandwidth"
+	case strings.HasPrefix(dimension, "devices"):
+		return "devices"
+	}
+	return dimension
+}
+
+// blockedEvals remembers the evaluations that blocked evaluations were
+// created by, they're complete and don't change, so each one is fetched
+// once. An evaluation that's gone is remembered as nil
+type blockedEvals struct {
+	mu       sync.Mutex
+	previous map[string]*api.Evaluation
+}
+
+// blockedEvalFailures returns the evaluations that failed to place the task
+// groups the blocked evaluations wait for, from the list when they're in it
+// or fetched otherwise
+func (e *Exporter) blockedEvalFailures(evals []*evaluation) []*api.Evaluation {
+	listed := make(map[string]*api.Evaluation, len(evals))
+	for _, eval := range evals {
+		listed[eval.ID] = &eval.Evaluation
+	}
+
+	e.blockedEvals.mu.Lock()
+	defer e.blockedEvals.mu.Unlock()
+
+	previous := make(map[string]*api.Evaluation)
+	var failures []*api.Evaluation
+	for _, eval := range evals {
+		if eval.Status != "blocked" || eval.PreviousEval == "" {
+			continue
+		}
+
+		prev, ok := listed[eval.PreviousEval]
+		if !ok {
+			prev, ok = e.blockedEvals.previous[eval.PreviousEval]
+		}
+		if !ok {
+			var err error
+			prev, _, err = e.client.Evaluations().Info(eval.PreviousEval, e.queryOptions("evals"))
+			if err != nil {
+				logrus.Debugf("Could not get evaluation %s that blocked evaluation %s was created by: %s",
+					eval.PreviousEval, eval.ID, err)
+				prev = nil
+			}
+		}
+		previous[eval.PreviousEval] = prev
+		if prev != nil {
+			failures = append(failures, prev)
+		}
+	}
+	e.blockedEvals.previous = previous
+	return failures
+}
+
+// collectBlockedEvals collects how many task groups of the blocked
+// evaluations couldn't be placed for lack of each resource and of nodes of
+// each class, from the placement failures of the evaluations that created
+// them
+func (e *Exporter) collectBlockedEvals(evals []*evaluation, ch chan<- prometheus.Metric) {
+	dimensions := make(map[string]float64)
+	classes := make(map[string]float64)
+	for _, eval := range e.blockedEvalFailures(evals) {
+		for _, metric := range eval.FailedTGAllocs {
+			if metric == nil {
+				continue
+			}
+
+			exhausted := make(map[string]bool)
+			for dimension, n := range metric.DimensionExhausted {
+				if n > 0 {
+					exhausted[exhaustedDimension(dimension)] = true
+				}
+			}
+			if len(metric.ConstraintFiltered) > 0 || len(metric.ClassFiltered) > 0 {
+				exhausted["constraint"] = true
+			}
+			for dimension := range exhausted {
+				dimensions[dimension]++
+			}
+
+			for class, n := range metric.ClassExhausted {
+				if n > 0 {
+					classes[class]++
+				}
+			}
+		}
+	}
+
+	for dimension, n := range dimensions {
+		ch <- prometheus.MustNewConstMetric(
+			blockedEvalsExhausted, prometheus.GaugeValue, n, dimension,
+		)
+	}
+	for class, n := range classes {
+		ch <- prometheus.MustNewConstMetric(
+			blockedEvalsClassExhausted, prometheus.GaugeValue, n, class,
+		)
+	}
+}
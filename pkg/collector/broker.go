@@ -0,0 +1,150 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// agentMetrics is the part of the agent telemetry summary served at
+// /v1/metrics the exporter reads
+type agentMetrics struct {
+	Gauges []struct {
+		Name  string
+		Value float64
+	}
+	Counters []agentSample
+	Samples  []agentSample
+}
+
+// agentSample is a counter or a timer of the agent telemetry, aggregated
+// over the last telemetry interval. Timers are in milliseconds
+type agentSample struct {
+	Name   string
+	Count  int
+	Sum    float64
+	Mean   float64
+	Max    float64
+	Labels map[string]string
+}
+
+// planOperations are the plan timers of the leader, from submitting a plan
+// to applying it to the state
+var planOperations = map[string]bool{
+	"submit":         true,
+	"evaluate":       true,
+	"apply":          true,
+	"wait_for_index": true,
+}
+
+// telemetryHost is the host name in the telemetry metric name, which is
+// prefixed with the service name and the host name unless it's disabled,
+// and the fallback otherwise
+func telemetryHost(name, metric, fallback string) string {
+	prefix := strings.TrimSuffix(name, metric)
+	if i := strings.Index(prefix, "."); i >= 0 && i < len(prefix)-1 {
+		return prefix[i+1:]
+	}
+	return fallback
+}
+
+// collectBrokerMetrics collects the eval broker and plan queue gauges from
+// the agent telemetry, the agent self stats don't include them. Only the
+// leader runs the broker, so they're only exported when talking to it
+func (e *Exporter) collectBrokerMetrics(ch chan<- prometheus.Metric) error {
+	if !e.amILeader {
+		return nil
+	}
+
+	var m agentMetrics
+	o := newLatencyObserver("get_agent_metrics")
+	_, err := e.client.Raw().Query("/v1/metrics", &m, nil)
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("could not get agent metrics: %s", err)
+	}
+
+	for _, g := range m.Gauges {
+		// gauges are prefixed with the service name and optionally the host name
+		if i := strings.Index(g.Name, ".nomad.broker."); i >= 0 {
+			parts := strings.Split(g.Name[i+len(".nomad.broker."):], ".")
+			switch {
+			case len(parts) == 1 && strings.HasPrefix(parts[0], "total_"):
+				ch <- prometheus.MustNewConstMetric(
+					brokerEvals, prometheus.GaugeValue, g.Value,
+					strings.TrimPrefix(parts[0], "total_"),
+				)
+			case len(parts) == 2:
+				ch <- prometheus.MustNewConstMetric(
+					brokerSchedulerEvals, prometheus.GaugeValue, g.Value,
+					parts[0], parts[1],
+				)
+			}
+			continue
+		}
+
+		if strings.HasSuffix(g.Name, ".nomad.plan.queue_depth") {
+			ch <- prometheus.MustNewConstMetric(
+				planQueueDepth, prometheus.GaugeValue, g.Value,
+			)
+		}
+	}
+
+	e.collectPlanMetrics(m, ch)
+	return nil
+}
+
+// collectPlanMetrics collects how long the leader took to submit, evaluate
+// and apply plans and how many nodes it rejected plans for over the last
+// telemetry interval. Rejections are counted only by nomad 1.3 and later
+func (e *Exporter) collectPlanMetrics(m agentMetrics, ch chan<- prometheus.Metric) {
+	e.leaderTracker.mu.Lock()
+	leader := e.leaderTracker.leader
+	e.leaderTracker.mu.Unlock()
+
+	for _, s := range m.Samples {
+		i := strings.Index(s.Name, ".nomad.plan.")
+		if i < 0 {
+			continue
+		}
+		operation := s.Name[i+len(".nomad.plan."):]
+		if !planOperations[operation] {
+			continue
+		}
+
+		server := telemetryHost(s.Name, ".nomad.plan."+operation, leader)
+		ch <- prometheus.MustNewConstMetric(
+			planOperationCount, prometheus.GaugeValue, float64(s.Count),
+			server, operation,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			planOperationMean, prometheus.GaugeValue, s.Mean/1000,
+			server, operation,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			planOperationMax, prometheus.GaugeValue, s.Max/1000,
+			server, operation,
+		)
+	}
+
+	rejections := make(map[string]float64)
+	for _, c := range m.Counters {
+		if !strings.HasSuffix(c.Name, ".nomad.plan.node_rejected") {
+			continue
+		}
+		server := telemetryHost(c.Name, ".nomad.plan.node_rejected", leader)
+		rejections[server] += c.Sum
+		if node := c.Labels["node_id"]; node != "" {
+			ch <- prometheus.MustNewConstMetric(
+				planNodeRejections, prometheus.GaugeValue, c.Sum,
+				server, node,
+			)
+		}
+	}
+	for server, total := range rejections {
+		ch <- prometheus.MustNewConstMetric(
+			planRejections, prometheus.GaugeValue, total, server,
+		)
+	}
+}
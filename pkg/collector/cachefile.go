@@ -0,0 +1,181 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/sirupsen/logrus"
+)
+
+// cacheFileVersion changes whenever the entries or their keys change, a file
+// of another version is ignored
+const cacheFileVersion = 5
+
+// cacheFile keeps the nodes and the jobs the exporter fetched in a file, so
+// a restarted exporter only fetches what changed in the meantime instead of
+// every node and job at once. It's written in the background after the
+// collections, the scrapes don't wait on the disk
+type cacheFile struct {
+	path    string
+	mu      sync.Mutex
+	pending chan struct{}
+}
+
+func newCacheFile(path string) *cacheFile {
+	return &cacheFile{
+		path:    path,
+		pending: make(chan struct{}, 1),
+	}
+}
+
+// run saves the caches whenever a collection asks for it, until the
+// exporter stops
+func (f *cacheFile) run(e *Exporter) {
+	for range f.pending {
+		if err := f.save(e); err != nil {
+			logrus.Errorf("could not save the cache: %s", err)
+		}
+	}
+}
+
+// request asks for the caches to be saved. A request made while one is
+// pending is dropped, the pending one saves its changes too
+func (f *cacheFile) request() {
+	select {
+	case f.pending <- struct{}{}:
+	default:
+	}
+}
+
+// cacheFileData is what the file holds, the jobs by namespace and id
+type cacheFileData struct {
+	Version  int                      `json:"version"`
+	Nodes    map[string]*api.Node     `json:"nodes"`
+	JobSpecs map[string]cachedJobSpec `json:"job_specs"`
+}
+
+type cachedJobSpec struct {
+	ModifyIndex  uint64                  `json:"modify_index"`
+	Counts       map[string]int          `json:"counts"`
+	Requests     map[string]groupRequest `json:"requests"`
+	Tasks        int                     `json:"tasks"`
+	Integrations map[string]int          `json:"integrations"`
+	Meta         map[string]string       `json:"meta,omitempty"`
+	Periodic     *api.PeriodicConfig     `json:"periodic,omitempty"`
+}
+
+// load fills the caches of the exporter from the file, a missing file is
+// an empty cache
+func (f *cacheFile) load(e *Exporter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var data cacheFileData
+	if err := json.Unmarshal(b, &data); err != nil {
+		return fmt.Errorf("could not decode cache file %s: %s", f.path, err)
+	}
+	if data.Version != cacheFileVersion {
+		return fmt.Errorf("cache file %s is version %d, expected %d", f.path, data.Version, cacheFileVersion)
+	}
+
+	e.nodeCache.mu.Lock()
+	for id, n := range data.Nodes {
+		e.nodeCache.nodes[id] = n
+	}
+	e.nodeCache.mu.Unlock()
+
+	e.jobSpecs.mu.Lock()
+	for key, spec := range data.JobSpecs {
+		e.jobSpecs.cache[key] = jobSpecEntry{
+			modifyIndex:  spec.ModifyIndex,
+			counts:       spec.Counts,
+			requests:     spec.Requests,
+			tasks:        spec.Tasks,
+			integrations: spec.Integrations,
+			meta:         spec.Meta,
+			periodic:     spec.Periodic,
+		}
+	}
+	e.jobSpecs.mu.Unlock()
+
+	logrus.Infof("Loaded %d nodes and %d job specifications from %s",
+		len(data.Nodes), len(data.JobSpecs), f.path)
+	return nil
+}
+
+// save writes the caches of the exporter to the file when they changed
+// since they were last written. The file is written to a temporary file
+// first and renamed so it's never read half written
+func (f *cacheFile) save(e *Exporter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, changed := e.cacheFileData()
+	if !changed {
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), "."+filepath.Base(f.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// cacheFileData copies the caches when any of them changed since the last
+// call
+func (e *Exporter) cacheFileData() (*cacheFileData, bool) {
+	e.nodeCache.mu.Lock()
+	defer e.nodeCache.mu.Unlock()
+	e.jobSpecs.mu.Lock()
+	defer e.jobSpecs.mu.Unlock()
+
+	if !e.nodeCache.changed && !e.jobSpecs.changed {
+		return nil, false
+	}
+
+	data := &cacheFileData{
+		Version:  cacheFileVersion,
+		Nodes:    make(map[string]*api.Node, len(e.nodeCache.nodes)),
+		JobSpecs: make(map[string]cachedJobSpec, len(e.jobSpecs.cache)),
+	}
+	for id, n := range e.nodeCache.nodes {
+		data.Nodes[id] = n
+	}
+	for key, entry := range e.jobSpecs.cache {
+		data.JobSpecs[key] = cachedJobSpec{
+			ModifyIndex:  entry.modifyIndex,
+			Counts:       entry.counts,
+			Requests:     entry.requests,
+			Tasks:        entry.tasks,
+			Integrations: entry.integrations,
+			Meta:         entry.meta,
+			Periodic:     entry.periodic,
+		}
+	}
+	e.nodeCache.changed = false
+	e.jobSpecs.changed = false
+	return data, true
+}
@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// nodeCircuits stops querying the nodes whose calls failed too many times in
+// a row until the cooldown passes, then lets one collection through to find
+// out whether they recovered. A wedged client agent would otherwise add its
+// timeouts to every collection
+type nodeCircuits struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu    sync.Mutex
+	nodes map[string]*nodeCircuit
+}
+
+type nodeCircuit struct {
+	name      string
+	failures  int
+	openUntil time.Time
+}
+
+func newNodeCircuits(threshold int, cooldown time.Duration) *nodeCircuits {
+	return &nodeCircuits{
+		threshold: threshold,
+		cooldown:  cooldown,
+		nodes:     make(map[string]*nodeCircuit),
+	}
+}
+
+// allow tells whether the node can be queried
+func (c *nodeCircuits) allow(id string) bool {
+	if c.threshold <= 0 {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, ok := c.nodes[id]
+	return !ok || time.Now().After(n.openUntil)
+}
+
+// record accounts the result of querying the node, opening its circuit when
+// it failed threshold times in a row
+func (c *nodeCircuits) record(id, name string, err error) {
+	if c.threshold <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil {
+		delete(c.nodes, id)
+		return
+	}
+
+	n, ok := c.nodes[id]
+	if !ok {
+		n = &nodeCircuit{name: name}
+		c.nodes[id] = n
+	}
+	n.failures++
+	if n.failures >= c.threshold {
+		n.openUntil = time.Now().Add(c.cooldown)
+	}
+}
+
+// prune forgets the nodes that are no longer in the cluster
+func (c *nodeCircuits) prune(nodes nodeMap) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id := range c.nodes {
+		if _, ok := nodes[id]; !ok {
+			delete(c.nodes, id)
+		}
+	}
+}
+
+func (c *nodeCircuits) collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for id, n := range c.nodes {
+		var open float64
+		if now.Before(n.openUntil) {
+			open = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			nodeCircuitOpen, prometheus.GaugeValue, open, n.name, id,
+		)
+	}
+}
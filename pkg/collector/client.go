@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Exporter modes define which agent the exporter talks to
+const (
+	ModeCluster = "cluster"
+	ModeClient  = "client"
+)
+
+// collectClient collects the metrics of the local nomad client only, the
+// node resources and the stats of the allocations running on it, returning
+// whether any of the collectors failed
+func (e *Exporter) collectClient(ch chan<- prometheus.Metric) (failed bool) {
+	var node *api.Node
+	if err := measure("local_node", func() error {
+		n, err := e.fetchLocalNode()
+		node = n
+		return err
+	}); err != nil {
+		ch <- prometheus.MustNewConstMetric(
+			up, prometheus.GaugeValue, 0,
+		)
+		LogError(err)
+		return true
+	}
+	ch <- prometheus.MustNewConstMetric(
+		up, prometheus.GaugeValue, 1,
+	)
+
+	ch <- clientErrors
+
+	if e.toggles.enabled("integration") {
+		if err := e.collectScheduled("integration", "integrations", ch, e.collectIntegrationMetrics); err != nil {
+			LogError(err)
+			failed = true
+		}
+	}
+
+	if e.toggles.enabled("node") {
+		if err := e.collectScheduled("node", "nodes", ch, func(ch chan<- prometheus.Metric) error {
+			e.collectNodeCost(node, ch)
+			return e.collectNodeResources(node, nil, nil, nil, ch)
+		}); err != nil {
+			LogError(err)
+			failed = true
+		}
+	}
+
+	if e.toggles.enabled("allocations") {
+		if err := e.collectScheduled("allocations", "allocations", ch, func(ch chan<- prometheus.Metric) error {
+			return e.collectLocalAllocations(node, ch)
+		}); err != nil {
+			LogError(err)
+			failed = true
+		}
+	}
+
+	return failed
+}
+
+func (e *Exporter) fetchLocalNode() (*api.Node, error) {
+	self, err := e.client.Agent().Self()
+	if err != nil {
+		return nil, fmt.Errorf("could not get local agent: %s", err)
+	}
+
+	nodeID := self.Stats["client"]["node_id"]
+	if nodeID == "" {
+		return nil, fmt.Errorf("local agent is not a nomad client")
+	}
+
+	node, _, err := e.client.Nodes().Info(nodeID, e.queryOptions("nodes"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local node %s info: %s", nodeID, err)
+	}
+	return node, nil
+}
+
+func (e *Exporter) collectLocalAllocations(node *api.Node, ch chan<- prometheus.Metric) error {
+	allocs, err := e.getRunningAllocs(node.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get local node %s running allocs: %s", node.Name, err)
+	}
+	logrus.Debugf("Collecting stats of %d local allocations", len(allocs))
+
+	for _, alloc := range allocs {
+		if err := e.collectAllocationStats(alloc, node.Datacenter, node.Name, ch); err != nil {
+			LogError(err)
+		}
+	}
+	e.allocationJobs.prune()
+	return nil
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collections tracks whether the collections succeed, as up stays 1 while
+// the collectors fail when e.g. the token is revoked, and the series just
+// go stale
+type collections struct {
+	mu          sync.Mutex
+	lastSuccess time.Time
+	failures    int
+	count       uint64
+}
+
+func (c *collections) record(failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if failed {
+		c.failures++
+		return
+	}
+	c.lastSuccess = time.Now()
+}
+
+// start numbers a new collection
+func (c *collections) start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count++
+}
+
+// number returns how many collections started
+func (c *collections) number() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count
+}
+
+// succeeded tells whether a collection ever succeeded
+func (c *collections) succeeded() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.lastSuccess.IsZero()
+}
+
+func (c *collections) collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var lastSuccess float64
+	if !c.lastSuccess.IsZero() {
+		lastSuccess = float64(c.lastSuccess.UnixNano()) / 1e9
+	}
+	ch <- prometheus.MustNewConstMetric(
+		lastCollectSuccess, prometheus.GaugeValue, lastSuccess,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		collectFailures, prometheus.CounterValue, float64(c.failures),
+	)
+}
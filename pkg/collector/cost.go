@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CostConfig prices the nodes by the hour, by the value of a node attribute
+type CostConfig struct {
+	// Attribute is the attribute the nodes are priced by, node.class, or
+	// attr. or meta. followed by the name of a node attribute or meta key as
+	// in nomad constraints. The node class when empty
+	Attribute string `json:"attribute"`
+	// Costs is the hourly cost of the nodes by attribute value
+	Costs map[string]float64 `json:"costs"`
+	// Default is the hourly cost of the nodes whose value has no cost, they
+	// aren't priced when it's missing
+	Default *float64 `json:"default"`
+}
+
+// LoadCostConfig reads the JSON cost config from path
+func LoadCostConfig(path string) (*CostConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read cost config: %s", err)
+	}
+
+	var c CostConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("could not parse cost config %s: %s", path, err)
+	}
+	if c.Attribute == "" {
+		c.Attribute = "node.class"
+	}
+	if c.Attribute != "node.class" && !strings.HasPrefix(c.Attribute, "attr.") && !strings.HasPrefix(c.Attribute, "meta.") {
+		return nil, fmt.Errorf("invalid attribute %s in %s, should be node.class, attr.<name> or meta.<name>", c.Attribute, path)
+	}
+	for value, cost := range c.Costs {
+		if cost < 0 {
+			return nil, fmt.Errorf("negative cost %g of %s in %s", cost, value, path)
+		}
+	}
+	if c.Default != nil && *c.Default < 0 {
+		return nil, fmt.Errorf("negative default cost %g in %s", *c.Default, path)
+	}
+	return &c, nil
+}
+
+// nodeCost returns the hourly cost of the node, false when it isn't priced
+func (c *CostConfig) nodeCost(n *api.Node) (float64, bool) {
+	var value string
+	switch {
+	case c.Attribute == "node.class":
+		value = n.NodeClass
+	case strings.HasPrefix(c.Attribute, "attr."):
+		value = n.Attributes[strings.TrimPrefix(c.Attribute, "attr.")]
+	case strings.HasPrefix(c.Attribute, "meta."):
+		value = n.Meta[strings.TrimPrefix(c.Attribute, "meta.")]
+	}
+
+	if cost, ok := c.Costs[value]; ok {
+		return cost, true
+	}
+	if c.Default != nil {
+		return *c.Default, true
+	}
+	return 0, false
+}
+
+// collectNodeCost exports the hourly cost of the node, whatever its status
+func (e *Exporter) collectNodeCost(n *api.Node, ch chan<- prometheus.Metric) {
+	if e.Costs == nil {
+		return
+	}
+	cost, ok := e.Costs.nodeCost(n)
+	if !ok {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		nodeCost, prometheus.GaugeValue, cost,
+		n.Name, n.Datacenter, n.NodeClass,
+	)
+}
+
+// addJobCosts adds the share of the cost of the node of every job running on
+// it to the job costs. A job's share is its dominant share of the resources
+// of the node less the reserved ones, the larger of its cpu and memory
+// shares, so a node whose memory is all allocated is all paid for even when
+// its cpu is idle. The dominant shares of different resources can add up to
+// more than the node, a cpu heavy job next to a memory heavy one, they're
+// scaled down to the whole node then so the jobs never pay more than it costs
+func (e *Exporter) addJobCosts(n *api.Node, allocatable allocatedTotals, allocated allocatedTotals, jobCosts *labeledCounts) {
+	cost, ok := e.Costs.nodeCost(n)
+	if !ok || allocatable.cpu <= 0 || allocatable.memoryMB <= 0 {
+		return
+	}
+
+	shares := make(map[allocatedJob]float64, len(allocated.jobs))
+	var total float64
+	for job, resources := range allocated.jobs {
+		share := float64(resources.cpu) / float64(allocatable.cpu)
+		if memory := float64(resources.memoryMB) / float64(allocatable.memoryMB); memory > share {
+			share = memory
+		}
+		shares[job] = share
+		total += share
+	}
+	scale := 1.0
+	if total > 1 {
+		scale = 1 / total
+	}
+	for job, share := range shares {
+		jobCosts.add(cost*share*scale, job.id, job.namespace)
+	}
+}
@@ -0,0 +1,67 @@
+package collector
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labeledCount is the value of a set of label values
+type labeledCount struct {
+	labels []string
+	value  float64
+}
+
+// labeledCounts adds up values by label values over a collection and sends
+// them as const metrics. Every collection counts in its own, so a scrape
+// never reads counts another collection is resetting or filling
+type labeledCounts struct {
+	desc *prometheus.Desc
+
+	mu     sync.Mutex
+	counts map[string]*labeledCount
+}
+
+func newLabeledCounts(desc *prometheus.Desc) *labeledCounts {
+	return &labeledCounts{
+		desc:   desc,
+		counts: make(map[string]*labeledCount),
+	}
+}
+
+// count returns the count of the label values, in the order of the desc
+func (c *labeledCounts) count(labels []string) *labeledCount {
+	key := strings.Join(labels, "\xff")
+	lc, ok := c.counts[key]
+	if !ok {
+		lc = &labeledCount{labels: labels}
+		c.counts[key] = lc
+	}
+	return lc
+}
+
+// add adds the value to the count of the label values
+func (c *labeledCounts) add(value float64, labels ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count(labels).value += value
+}
+
+// set sets the count of the label values
+func (c *labeledCounts) set(value float64, labels ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count(labels).value = value
+}
+
+func (c *labeledCounts) collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, lc := range c.counts {
+		ch <- prometheus.MustNewConstMetric(
+			c.desc, prometheus.GaugeValue, lc.value, lc.labels...,
+		)
+	}
+}
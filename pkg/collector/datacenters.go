@@ -0,0 +1,153 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// datacenterCapacity is what the ready nodes of a datacenter can run and
+// what's allocated on them
+type datacenterCapacity struct {
+	allocatableCPU    float64
+	allocatableMemory float64
+	allocatedCPU      float64
+	allocatedMemory   float64
+}
+
+type datacenterStatusKey struct {
+	datacenter, status string
+}
+
+// datacenterTotals sums the nodes of a collection per datacenter and for the
+// region, so capacity alerts don't have to sum thousands of node series. The
+// region totals are left out when the region isn't known, the allocated
+// resources when they aren't read
+type datacenterTotals struct {
+	region    string
+	allocated bool
+
+	mu       sync.Mutex
+	nodes    map[datacenterStatusKey]int
+	capacity map[string]*datacenterCapacity
+}
+
+func newDatacenterTotals(region string, allocated bool) *datacenterTotals {
+	return &datacenterTotals{
+		region:    region,
+		allocated: allocated,
+		nodes:     make(map[datacenterStatusKey]int),
+		capacity:  make(map[string]*datacenterCapacity),
+	}
+}
+
+// agentRegion remembers the region of the servers the exporter talks to
+type agentRegion struct {
+	mu   sync.Mutex
+	name string
+}
+
+// region returns the region of the servers, the agent is asked until it
+// answers
+func (e *Exporter) region() (string, error) {
+	r := e.agentRegion
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.name != "" {
+		return r.name, nil
+	}
+	name, err := e.client.Agent().Region()
+	if err != nil {
+		return "", fmt.Errorf("could not get the region of the agent: %s", err)
+	}
+	r.name = name
+	return name, nil
+}
+
+func (d *datacenterTotals) addNode(datacenter, status string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nodes[datacenterStatusKey{datacenter, status}]++
+}
+
+// addCapacity adds the resources of a node, less the reserved ones, or the
+// resources allocated on it
+func (d *datacenterTotals) addCapacity(datacenter string, c datacenterCapacity) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t, ok := d.capacity[datacenter]
+	if !ok {
+		t = &datacenterCapacity{}
+		d.capacity[datacenter] = t
+	}
+	t.allocatableCPU += c.allocatableCPU
+	t.allocatableMemory += c.allocatableMemory
+	t.allocatedCPU += c.allocatedCPU
+	t.allocatedMemory += c.allocatedMemory
+}
+
+func (d *datacenterTotals) collect(ch chan<- prometheus.Metric) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	regionNodes := make(map[string]int)
+	for key, count := range d.nodes {
+		ch <- prometheus.MustNewConstMetric(
+			datacenterNodes, prometheus.GaugeValue, float64(count),
+			key.datacenter, key.status,
+		)
+		regionNodes[key.status] += count
+	}
+
+	var region datacenterCapacity
+	for datacenter, c := range d.capacity {
+		ch <- prometheus.MustNewConstMetric(
+			datacenterAllocatableCPU, prometheus.GaugeValue, c.allocatableCPU, datacenter,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			datacenterAllocatableMemory, prometheus.GaugeValue, c.allocatableMemory, datacenter,
+		)
+		if d.allocated {
+			ch <- prometheus.MustNewConstMetric(
+				datacenterAllocatedCPU, prometheus.GaugeValue, c.allocatedCPU, datacenter,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				datacenterAllocatedMemory, prometheus.GaugeValue, c.allocatedMemory, datacenter,
+			)
+		}
+		region.allocatableCPU += c.allocatableCPU
+		region.allocatableMemory += c.allocatableMemory
+		region.allocatedCPU += c.allocatedCPU
+		region.allocatedMemory += c.allocatedMemory
+	}
+
+	if d.region == "" {
+		return
+	}
+	for status, count := range regionNodes {
+		ch <- prometheus.MustNewConstMetric(
+			regionNodeCount, prometheus.GaugeValue, float64(count), d.region, status,
+		)
+	}
+	if len(d.capacity) == 0 {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		regionAllocatableCPU, prometheus.GaugeValue, region.allocatableCPU, d.region,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		regionAllocatableMemory, prometheus.GaugeValue, region.allocatableMemory, d.region,
+	)
+	if d.allocated {
+		ch <- prometheus.MustNewConstMetric(
+			regionAllocatedCPU, prometheus.GaugeValue, region.allocatedCPU, d.region,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			regionAllocatedMemory, prometheus.GaugeValue, region.allocatedMemory, d.region,
+		)
+	}
+}
@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// deploymentRollbackDescription is what nomad appends to the status
+// description of a failed deployment when it auto reverts the job
+const deploymentRollbackDescription = " - rolling back to job version "
+
+// deploymentTransitions remembers the deployment statuses between collections
+// to count the deployments that failed or were auto reverted since
+type deploymentTransitions struct {
+	mu     sync.Mutex
+	status map[string]string
+}
+
+// observe counts the deployments that became failed since the last call and
+// returns them, the first call only records the current statuses
+func (d *deploymentTransitions) observe(deployments []*api.Deployment) []*api.Deployment {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var failed []*api.Deployment
+	status := make(map[string]string, len(deployments))
+	for _, dep := range deployments {
+		status[dep.ID] = dep.Status
+
+		if d.status == nil || dep.Status != "failed" || d.status[dep.ID] == dep.Status {
+			continue
+		}
+		failed = append(failed, dep)
+		deploymentFailed.WithLabelValues(dep.JobID).Inc()
+		if strings.Contains(dep.StatusDescription, deploymentRollbackDescription) {
+			deploymentAutoReverted.WithLabelValues(dep.JobID).Inc()
+		}
+	}
+	d.status = status
+	return failed
+}
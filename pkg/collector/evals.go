@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// evaluation is an evaluation as listed by the api, with the timestamps nomad
+// 0.10.2 added that the api package doesn't know about
+type evaluation struct {
+	api.Evaluation
+	CreateTime int64
+	ModifyTime int64
+}
+
+// waited is how long the evaluation was delayed before it could be
+// processed, either for a fixed time or until a given time
+func (e *evaluation) waited() time.Duration {
+	if !e.WaitUntil.IsZero() {
+		if d := e.WaitUntil.Sub(time.Unix(0, e.CreateTime)); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return e.Wait
+}
+
+// evalLatencies remembers the evaluations already observed between
+// collections, so every evaluation is observed once when it's done
+type evalLatencies struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// observe records how long the evaluations done since the last call waited
+// and were processed for, the first call only records the current ones.
+// Evaluations without timestamps, from servers before 0.10.2, are skipped
+func (l *evalLatencies) observe(evals []*evaluation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seen := make(map[string]bool, len(evals))
+	for _, eval := range evals {
+		switch eval.Status {
+		case "complete", "failed":
+		default:
+			continue
+		}
+		seen[eval.ID] = true
+
+		if l.seen == nil || l.seen[eval.ID] || eval.CreateTime == 0 || eval.ModifyTime < eval.CreateTime {
+			continue
+		}
+
+		wait := eval.waited()
+		processing := time.Duration(eval.ModifyTime-eval.CreateTime) - wait
+		if processing < 0 {
+			processing = 0
+		}
+		evalWaitSeconds.WithLabelValues(eval.Type).Observe(wait.Seconds())
+		evalProcessingSeconds.WithLabelValues(eval.Type).Observe(processing.Seconds())
+	}
+	l.seen = seen
+}
@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Kinds of the events the collector notices
+const (
+	EventZombieAllocation = "zombie_allocation"
+	EventNodeIneligible   = "node_ineligible"
+	EventDeploymentFailed = "deployment_failed"
+)
+
+// Event is a condition the collector noticed between two collections, about
+// the object the subject is the id of
+type Event struct {
+	Kind    string            `json:"kind"`
+	Subject string            `json:"subject"`
+	Labels  map[string]string `json:"labels"`
+	Time    time.Time         `json:"time"`
+}
+
+// notify passes the event to the OnEvent option, when set
+func (e *Exporter) notify(kind, subject string, labels map[string]string) {
+	if e.OnEvent == nil {
+		return
+	}
+	e.OnEvent(Event{
+		Kind:    kind,
+		Subject: subject,
+		Labels:  labels,
+		Time:    time.Now(),
+	})
+}
+
+// nodeEligibility remembers the scheduling eligibility of the nodes between
+// collections to notice the nodes that became ineligible
+type nodeEligibility struct {
+	mu       sync.Mutex
+	eligible map[string]bool
+}
+
+// observe returns the nodes that became ineligible since the last call, the
+// first call only records the current eligibility
+func (n *nodeEligibility) observe(nodes nodeMap) []*api.NodeListStub {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var ineligible []*api.NodeListStub
+	eligible := make(map[string]bool, len(nodes))
+	for id, node := range nodes {
+		eligible[id] = node.SchedulingEligibility == api.NodeSchedulingEligible
+		if was, ok := n.eligible[id]; ok && was && !eligible[id] {
+			ineligible = append(ineligible, node)
+		}
+	}
+	n.eligible = eligible
+	return ineligible
+}
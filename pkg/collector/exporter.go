@@ -0,0 +1,1950 @@
+// Package collector collects the metrics of a nomad cluster, or of a single
+// nomad client, as a prometheus collector
+package collector
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Options configures what the exporter collects and how
+type Options struct {
+	Mode                          string
+	CollectMode                   string
+	PeerMetricsEnabled            bool
+	SerfMetricsEnabled            bool
+	NodeMetricsEnabled            bool
+	JobMetricEnabled              bool
+	AllocationsMetricsEnabled     bool
+	EvalMetricsEnabled            bool
+	DeploymentMetricsEnabled      bool
+	IntegrationMetricsEnabled     bool
+	BrokerMetricsEnabled          bool
+	AllocationStatsMetricsEnabled bool
+	KeyringMetricsEnabled         bool
+	PlacementMetricsEnabled       bool
+	FederationMetricsEnabled      bool
+	Snapshot                      bool
+	Concurrency                   int
+	AllocationConcurrency         int
+	AllocationStatsConcurrency    int
+	NamespaceConcurrency          int
+	UnixSocket                    bool
+	CumulativeCounters            bool
+	PendingThreshold              time.Duration
+	IncludeTerminalAllocations    bool
+	TerminalLookback              time.Duration
+	PerCPUMetrics                 bool
+	AllocationPortMetrics         bool
+	AllocationAggregation         string
+	AllocationTopK                int
+	PlacementMaxAge               time.Duration
+	JobMetaKeys                   string
+	FederationRegions             string
+	QueryOptions                  QueryConfig
+	CollectorQueryOptions         map[string]QueryConfig
+	NodeCircuitFailures           int
+	NodeCircuitCooldown           time.Duration
+	LocalStatsInterval            time.Duration
+	// PageSize lists the jobs, allocations and evaluations page by page, it
+	// needs the ClientConfig to read the next page token with
+	PageSize int
+	// CollectBudget aborts the collections running longer, 0 disables it
+	CollectBudget time.Duration
+	// CacheFile keeps the fetched nodes and jobs across restarts
+	CacheFile string
+	// Costs prices the nodes and the jobs running on them, nil disables it
+	Costs *CostConfig
+	// CollectorEvery runs the collectors every nth collection, serving
+	// their metrics from the last run in between
+	CollectorEvery map[string]int
+	// OnEvent is called with the conditions noticed between collections, it
+	// shouldn't block as it's called while collecting
+	OnEvent func(Event)
+	// Endpoint is the address the client talks to when it moves between
+	// several, the leader is compared with it instead of the client address
+	Endpoint Endpoint
+	// Election tells whether this exporter is the replica that collects the
+	// cluster metrics, the others only report whether the leader is up
+	Election Election
+	// ClientConfig is the config the client was created with. A collection
+	// aborted over the budget cancels the queries it still has in flight
+	// with it, without it they run on until nomad answers
+	ClientConfig *api.Config
+}
+
+// Election elects one of several exporter replicas
+type Election interface {
+	Active() bool
+}
+
+// Endpoint tells which of several nomad addresses the client talks to
+type Endpoint interface {
+	prometheus.Collector
+	Active() string
+}
+
+// Exporter is a nomad exporter
+type Exporter struct {
+	Options
+	client                *api.Client
+	sharedClient          *api.Client
+	amILeader             bool
+	localStats            *localAllocStats
+	deploymentTransitions *deploymentTransitions
+	evalLatencies         *evalLatencies
+	allocationFailures    *allocationFailures
+	blockedEvals          *blockedEvals
+	placementScores       *placementScores
+	batchCompletions      *batchCompletions
+	leaderTracker         *leaderTracker
+	zombies               *zombieList
+	jobMeta               *jobMeta
+	jobSpecs              *jobSpecs
+	snapshot              *snapshot
+	nodeEligibility       *nodeEligibility
+	allocationJobs        *allocationJobs
+	nodeCache             *nodeCache
+	nodePool              *workerPool
+	jobPool               *workerPool
+	pages                 *pageTokens
+	allocationPool        *workerPool
+	allocationStatsPool   *workerPool
+	nodeCircuits          *nodeCircuits
+	toggles               *collectorToggles
+	collections           *collections
+	schedule              *schedule
+	cacheFile             *cacheFile
+	namespacePool         *workerPool
+	flight                *flight
+	agentRegion           *agentRegion
+}
+
+// New validates the options and creates the exporter, without talking to
+// nomad yet
+func New(client *api.Client, opts Options) (*Exporter, error) {
+	if opts.Mode != ModeCluster && opts.Mode != ModeClient {
+		return nil, fmt.Errorf("invalid mode %s", opts.Mode)
+	}
+	if !validCollectMode(opts.CollectMode) {
+		return nil, fmt.Errorf("invalid collect mode %s", opts.CollectMode)
+	}
+	if !validAggregation(opts.AllocationAggregation) {
+		return nil, fmt.Errorf("invalid allocations aggregation %s", opts.AllocationAggregation)
+	}
+	if opts.PageSize < 0 {
+		return nil, fmt.Errorf("invalid page size %d", opts.PageSize)
+	}
+	if opts.PageSize > 0 && (opts.ClientConfig == nil || opts.ClientConfig.HttpClient == nil) {
+		return nil, fmt.Errorf("the page size needs the client config and its http client")
+	}
+	if opts.CollectBudget < 0 {
+		return nil, fmt.Errorf("invalid collection budget %s", opts.CollectBudget)
+	}
+	if opts.AllocationAggregation == AggregationTopK && opts.AllocationTopK < 1 {
+		return nil, fmt.Errorf("invalid allocations top k %d, expected at least 1", opts.AllocationTopK)
+	}
+
+	var meta *jobMeta
+	if opts.JobMetaKeys != "" {
+		var err error
+		if meta, err = newJobMeta(opts.JobMetaKeys); err != nil {
+			return nil, fmt.Errorf("could not parse job meta keys: %s", err)
+		}
+	}
+
+	e := &Exporter{
+		Options:               opts,
+		client:                client,
+		sharedClient:          client,
+		deploymentTransitions: &deploymentTransitions{},
+		evalLatencies:         &evalLatencies{},
+		allocationFailures:    &allocationFailures{},
+		blockedEvals:          &blockedEvals{},
+		placementScores:       &placementScores{scores: make(map[string][]*api.NodeScoreMeta)},
+		batchCompletions:      newBatchCompletions(),
+		leaderTracker:         &leaderTracker{},
+		zombies:               &zombieList{},
+		jobMeta:               meta,
+		jobSpecs:              newJobSpecs(),
+		nodeEligibility:       &nodeEligibility{},
+		allocationJobs:        newAllocationJobs(),
+		nodeCache:             newNodeCache(),
+		nodePool:              newWorkerPool("nodes", opts.Concurrency),
+		jobPool:               newWorkerPool("jobs", opts.Concurrency),
+		allocationPool:        newWorkerPool("allocations", opts.AllocationConcurrency),
+		allocationStatsPool:   newWorkerPool("allocation_stats", opts.AllocationStatsConcurrency),
+		nodeCircuits:          newNodeCircuits(opts.NodeCircuitFailures, opts.NodeCircuitCooldown),
+		collections:           &collections{},
+		flight:                &flight{budget: opts.CollectBudget},
+		agentRegion:           &agentRegion{},
+		toggles: newCollectorToggles(map[string]bool{
+			"peer":             opts.PeerMetricsEnabled,
+			"serf":             opts.SerfMetricsEnabled,
+			"node":             opts.NodeMetricsEnabled,
+			"jobs":             opts.JobMetricEnabled,
+			"allocations":      opts.AllocationsMetricsEnabled,
+			"eval":             opts.EvalMetricsEnabled,
+			"deployment":       opts.DeploymentMetricsEnabled,
+			"integration":      opts.IntegrationMetricsEnabled,
+			"broker":           opts.BrokerMetricsEnabled,
+			"allocation-stats": opts.AllocationStatsMetricsEnabled,
+			"keyring":          opts.KeyringMetricsEnabled,
+			"placement":        opts.PlacementMetricsEnabled,
+			"federation":       opts.FederationMetricsEnabled,
+		}),
+	}
+	if opts.Snapshot {
+		e.snapshot = &snapshot{}
+	}
+	if opts.NamespaceConcurrency > 0 {
+		e.namespacePool = newWorkerPool("namespaces", opts.NamespaceConcurrency)
+	}
+	if len(opts.CollectorEvery) > 0 {
+		e.schedule = newSchedule(opts.CollectorEvery)
+	}
+	if opts.CacheFile != "" {
+		e.cacheFile = newCacheFile(opts.CacheFile)
+		if err := e.cacheFile.load(e); err != nil {
+			// the cache only saves api calls, the exporter starts cold
+			logrus.Warnf("could not load the cache: %s", err)
+		}
+	}
+	if opts.LocalStatsInterval > 0 {
+		e.localStats = newLocalAllocStats(client, opts.LocalStatsInterval)
+	}
+	// the collectors query through a client of their own, whose requests are
+	// cancelled along with the collection they're made for and whose page
+	// tokens are kept
+	if client, ok := e.newClient(func(next http.RoundTripper) http.RoundTripper {
+		next = e.cancelled(next)
+		if opts.PageSize > 0 {
+			e.pages = newPageTokens(next)
+			next = e.pages
+		}
+		return next
+	}); ok {
+		e.client = client
+	} else if opts.PageSize > 0 {
+		return nil, fmt.Errorf("could not create the client to list page by page with")
+	}
+	return e, nil
+}
+
+// Start starts reading the local allocation stats and saving the cache file
+// in the background, when enabled
+func (e *Exporter) Start() {
+	if e.localStats != nil {
+		e.localStats.Start()
+	}
+	if e.cacheFile != nil {
+		go e.cacheFile.run(e)
+	}
+}
+
+// SaveCache writes the cache file right away, so an exporter about to exit
+// doesn't lose the changes of its last collection
+func (e *Exporter) SaveCache() error {
+	if e.cacheFile == nil {
+		return nil
+	}
+	return e.cacheFile.save(e)
+}
+
+// Client returns the nomad api client the exporter collects with
+func (e *Exporter) Client() *api.Client {
+	return e.sharedClient
+}
+
+// Zombies lists the zombie allocations found by the last collection as json
+func (e *Exporter) Zombies() http.Handler {
+	return e.zombies
+}
+
+// Snapshot serves the nodes, allocations, jobs and deployments the last
+// collection read as json, rewritten by relabel unless nil, nil unless
+// enabled in the options
+func (e *Exporter) Snapshot(relabel Relabel) http.Handler {
+	if e.snapshot == nil {
+		return nil
+	}
+	return &snapshotHandler{snapshot: e.snapshot, relabel: relabel}
+}
+
+// Collected tells whether a collection succeeded without errors since the
+// exporter started
+func (e *Exporter) Collected() bool {
+	return e.collections.succeeded()
+}
+
+// Collections returns how many collections started, it tells apart the
+// gathers that share a collection
+func (e *Exporter) Collections() uint64 {
+	return e.collections.number()
+}
+
+// Collectors tells whether every collector runs
+func (e *Exporter) Collectors() map[string]bool {
+	return e.toggles.state()
+}
+
+// SetCollector switches a collector on or off until the exporter stops
+func (e *Exporter) SetCollector(name string, enabled bool) error {
+	return e.toggles.set(name, enabled)
+}
+
+// ResetCollector makes a collector run as its options say again
+func (e *Exporter) ResetCollector(name string) error {
+	return e.toggles.reset(name)
+}
+
+// Collection modes define which exporters read cluster metrics
+const (
+	collectModeLeaderOnly     = "leader-only"
+	collectModeFollowersStale = "followers-stale"
+	collectModeAlways         = "always"
+)
+
+func validCollectMode(mode string) bool {
+	switch mode {
+	case collectModeLeaderOnly, collectModeFollowersStale, collectModeAlways:
+		return true
+	}
+	return false
+}
+
+func (e *Exporter) shouldReadMetrics() bool {
+	return e.amILeader || e.CollectMode != collectModeLeaderOnly
+}
+
+// queryOptions returns the options to query the api with for the collector,
+// falling back to the global ones when not overridden
+func (e *Exporter) queryOptions(collector string) *api.QueryOptions {
+	o, ok := e.CollectorQueryOptions[collector]
+	if !ok {
+		o = e.QueryOptions
+	}
+	if e.CollectMode == collectModeFollowersStale && !e.amILeader {
+		o.AllowStale = true
+	}
+	return &api.QueryOptions{
+		AllowStale: o.AllowStale,
+		WaitTime:   o.WaitTime,
+	}
+}
+
+// cumulativeMetric builds a metric for a monotonically increasing value, as a
+// counter when enabled or as the legacy gauge otherwise
+func (e *Exporter) cumulativeMetric(gauge, counter *prometheus.Desc, value float64, labels ...string) prometheus.Metric {
+	if e.CumulativeCounters {
+		return prometheus.MustNewConstMetric(counter, prometheus.CounterValue, value, labels...)
+	}
+	return prometheus.MustNewConstMetric(gauge, prometheus.GaugeValue, value, labels...)
+}
+
+// Describe implements Collector interface.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- up
+	ch <- metricsSuppressed
+	ch <- lastCollectSuccess
+	ch <- collectFailures
+	ch <- poolWorkers
+	ch <- poolQueueDepth
+	ch <- nodeCircuitOpen
+	ch <- collectorCached
+	if e.Endpoint != nil {
+		e.Endpoint.Describe(ch)
+	}
+	ch <- nodeInfo
+	ch <- nodeEligible
+	ch <- nodeCost
+	ch <- jobCost
+	ch <- clusterServers
+	ch <- serverVersion
+	ch <- serverMemberStatus
+	ch <- serverMemberProtocol
+	ch <- raftLastContact
+	ch <- raftServerProtocol
+	ch <- autopilotHealthy
+	ch <- autopilotFailureTolerance
+	ch <- autopilotServerHealthy
+	ch <- autopilotUpgradeMigration
+	ch <- serfLanMembers
+	ch <- serfLanMembersStatus
+	ch <- nodeStatusInfo
+	ch <- datacenterNodes
+	ch <- datacenterAllocatableCPU
+	ch <- datacenterAllocatableMemory
+	ch <- datacenterAllocatedCPU
+	ch <- datacenterAllocatedMemory
+	ch <- regionNodeCount
+	ch <- regionAllocatableCPU
+	ch <- regionAllocatableMemory
+	ch <- regionAllocatedCPU
+	ch <- regionAllocatedMemory
+	ch <- nodeStatusChanged
+	ch <- nodeMissedHeartbeats
+	ch <- raftAppliedIndex
+	ch <- raftCommitIndex
+	ch <- raftFsmPending
+	ch <- raftLastLogIndex
+	ch <- raftLastSnapshotIndex
+	ch <- raftNumPeers
+	ch <- brokerEvals
+	ch <- brokerSchedulerEvals
+	ch <- planQueueDepth
+	ch <- planOperationCount
+	ch <- planOperationMean
+	ch <- planOperationMax
+	ch <- planRejections
+	ch <- planNodeRejections
+	ch <- schedulerConfigInfo
+	ch <- schedulerMemoryOversubscription
+	ch <- schedulerPreemption
+	ch <- keyringKeys
+	ch <- keyringActiveKeyCreateTime
+	ch <- vaultUp
+	ch <- vaultTokenTTL
+	ch <- consulSyncFailures
+	ch <- jobsTotal
+	ch <- gcEligibleAllocations
+	ch <- gcEligibleJobs
+	ch <- gcEligibleEvals
+	ch <- evalsPending
+	ch <- deploymentsActive
+	ch <- blockedEvalsExhausted
+	ch <- blockedEvalsClassExhausted
+	ch <- jobsCount
+	ch <- jobPriority
+	ch <- jobAllocationsDesired
+	ch <- jobAllocationsRunning
+	ch <- jobGroupCount
+	ch <- jobGroupRequestedCPU
+	ch <- jobGroupRequestedMemory
+	ch <- jobGroupRequestedMemoryMax
+	ch <- jobGroupRequestedDisk
+	ch <- jobTasks
+	ch <- jobTaskIntegrations
+	ch <- jobStatus
+	ch <- jobSubmitTime
+	ch <- jobChildren
+	ch <- jobPeriodicNextLaunch
+	ch <- jobBatchAllocations
+	ch <- jobBatchLastComplete
+	ch <- allocationMemoryBytes
+	ch <- allocationCPUPercent
+	ch <- allocationCPUTicks
+	ch <- allocationCPUUserMode
+	ch <- allocationCPUSystemMode
+	ch <- allocationCPUThrottled
+	ch <- allocationCPUTicksTotal
+	ch <- allocationCPUUserModeTotal
+	ch <- allocationCPUSystemModeTotal
+	ch <- allocationCPUThrottledTotal
+	ch <- allocationMemoryBytesRequired
+	ch <- allocationCPURequired
+	ch <- taskCPUPercent
+	ch <- taskCPUTotalTicks
+	ch <- taskCPUTicksTotal
+	ch <- taskMemoryRssBytes
+	ch <- allocationMemoryStatBytes
+	ch <- taskMemoryStatBytes
+	ch <- allocationCreateTimestamp
+	ch <- allocationModifyTimestamp
+	ch <- taskStartedTimestamp
+	ch <- taskFinishedTimestamp
+	ch <- taskLastExitCode
+	ch <- taskLastExitSignal
+	ch <- taskLastExitOOMKilled
+	ch <- allocationDeploymentHealthy
+	ch <- allocationPlacementScore
+	ch <- regionUp
+	ch <- regionNodes
+	ch <- regionJobs
+	ch <- allocationPortInfo
+	ch <- groupAllocations
+	ch <- groupCPUPercent
+	ch <- groupMemoryBytes
+	ch <- groupMemoryStatBytes
+	ch <- groupMemoryBytesRequired
+	ch <- groupCPURequired
+	ch <- nodeOtherAllocations
+	ch <- nodeOtherAllocationsCPUPercent
+	ch <- nodeOtherAllocationsMemoryBytes
+	if e.jobMeta != nil {
+		ch <- e.jobMeta.desc
+	}
+	ch <- nodeResourceMemory
+	ch <- nodeAllocatedMemory
+	ch <- nodeUsedMemory
+	ch <- nodeResourceCPU
+	ch <- nodeResourceIOPS
+	ch <- nodeResourceDiskBytes
+	ch <- nodeAllocatedCPU
+	ch <- nodeUsedCPU
+	ch <- nodeReservedCPU
+	ch <- nodeReservedMemory
+	ch <- nodeMemoryOversubscribed
+	ch <- nodeReservedDiskBytes
+	ch <- nodeReservedPorts
+	ch <- nodeMemoryBytes
+	ch <- nodeCPUPercent
+	ch <- nodeDiskSizeBytes
+	ch <- nodeDiskUsedBytes
+	ch <- nodeDiskAvailableBytes
+	ch <- nodeDiskInodesUsedPercent
+
+	ch <- allocation
+	allocationsFailed.Describe(ch)
+	ch <- allocationZombies
+	ch <- allocationPendingStale
+	ch <- zombieAllocations
+	ch <- evalCount
+	evalWaitSeconds.Describe(ch)
+	evalProcessingSeconds.Describe(ch)
+	ch <- taskCount
+
+	ch <- deploymentCount
+	deploymentFailed.Describe(ch)
+	deploymentAutoReverted.Describe(ch)
+
+	ch <- deploymentTaskGroupDesiredCanaries
+	ch <- deploymentTaskGroupDesiredTotal
+	ch <- deploymentTaskGroupPlacedAllocs
+	ch <- deploymentTaskGroupHealthyAllocs
+	ch <- deploymentTaskGroupUnhealthyAllocs
+
+	clientErrors.Describe(ch)
+	coalescedScrapes.Describe(ch)
+	collectionsInFlight.Describe(ch)
+	collectionsAborted.Describe(ch)
+	ch <- exporterGoroutines
+	ch <- exporterHeapBytes
+	namespaceErrors.Describe(ch)
+	raftLeaderChanges.Describe(ch)
+	apiLatencySummary.Describe(ch)
+	apiNodeLatencySummary.Describe(ch)
+}
+
+// Collect collects nomad metrics, concurrent scrapes share a collection
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	metrics, shared := e.flight.do(e.collect)
+	if shared {
+		coalescedScrapes.Inc()
+	}
+	for _, m := range metrics {
+		ch <- m
+	}
+	ch <- coalescedScrapes
+	ch <- collectionsInFlight
+	ch <- collectionsAborted
+	collectRuntime(ch)
+}
+
+func (e *Exporter) collect(ch chan<- prometheus.Metric) {
+	var failed bool
+	e.collections.start()
+	e.schedule.tick()
+	if e.Mode == ModeClient {
+		failed = e.collectClient(ch)
+	} else {
+		e.snapshot.begin()
+		failed = e.collectCluster(ch)
+		e.snapshot.commit()
+		if e.cacheFile != nil {
+			e.cacheFile.request()
+		}
+	}
+	e.collections.record(failed)
+	e.collections.collect(ch)
+	e.schedule.collect(ch)
+
+	if e.namespacePool != nil {
+		e.namespacePool.collect(ch)
+		namespaceErrors.Collect(ch)
+	}
+
+	apiLatencySummary.Collect(ch)
+	apiNodeLatencySummary.Collect(ch)
+}
+
+// newClient returns a client like the shared one whose requests go through
+// the transport wrap returns, false when the exporter doesn't know the config
+// of the shared client
+func (e *Exporter) newClient(wrap func(http.RoundTripper) http.RoundTripper) (*api.Client, bool) {
+	if e.ClientConfig == nil || e.ClientConfig.HttpClient == nil {
+		return nil, false
+	}
+	config := *e.ClientConfig
+	httpClient := *config.HttpClient
+	httpClient.Transport = wrap(httpClient.Transport)
+	config.HttpClient = &httpClient
+	client, err := api.NewClient(&config)
+	if err != nil {
+		LogError(fmt.Errorf("could not create an api client: %s", err))
+		return nil, false
+	}
+	return client, true
+}
+
+// cancelled makes the requests be cancelled with the collection in
+// progress, if any
+func (e *Exporter) cancelled(next http.RoundTripper) http.RoundTripper {
+	return &contextTransport{flight: e.flight, next: next}
+}
+
+// collectScheduled runs the collector when the schedule says it's due, and
+// keeps its lists in the snapshot when it doesn't run
+func (e *Exporter) collectScheduled(collector, name string, ch chan<- prometheus.Metric,
+	collect func(chan<- prometheus.Metric) error) error {
+	schedule := e.schedule
+	if e.Mode == ModeCluster && !e.shouldReadMetrics() {
+		// suppressed collectors send next to nothing, that's not worth
+		// serving once the metrics are read again
+		schedule = nil
+	}
+	ran, err := schedule.run(collector, name, ch, func(ch chan<- prometheus.Metric) error {
+		return measure(name, func() error { return collect(ch) })
+	})
+	if !ran {
+		e.snapshot.carry(collector)
+	}
+	return err
+}
+
+// collectCluster collects the cluster metrics, returning whether any of the
+// collectors failed
+func (e *Exporter) collectCluster(ch chan<- prometheus.Metric) (failed bool) {
+	if err := measure("leader", func() error {
+		return e.collectLeader(ch)
+	}); err != nil {
+		ch <- prometheus.MustNewConstMetric(
+			up, prometheus.GaugeValue, 0,
+		)
+		LogError(err)
+		return true
+	}
+	ch <- prometheus.MustNewConstMetric(
+		up, prometheus.GaugeValue, 1,
+	)
+
+	if e.Election != nil && !e.Election.Active() {
+		logrus.Debugf("Standby replica, cluster metrics are collected by the active one")
+		return false
+	}
+
+	var suppressed float64
+	if !e.shouldReadMetrics() {
+		logrus.Debugf("Not the leader and collect mode is %s, cluster metrics are suppressed", e.CollectMode)
+		suppressed = 1
+		e.schedule.reset()
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricsSuppressed, prometheus.GaugeValue, suppressed,
+	)
+
+	ch <- clientErrors
+
+	if e.toggles.enabled("integration") {
+		if err := e.collectScheduled("integration", "integrations", ch, e.collectIntegrationMetrics); err != nil {
+			LogError(err)
+			failed = true
+		}
+	}
+
+	nodes, err := e.fetchNodes()
+	if err != nil {
+		LogError(err)
+		return true
+	}
+
+	if e.toggles.enabled("node") {
+		if err := e.collectScheduled("node", "nodes", ch, func(ch chan<- prometheus.Metric) error {
+			return e.collectNodes(nodes, ch)
+		}); err != nil {
+			LogError(err)
+			return true
+		}
+	}
+
+	if e.toggles.enabled("allocations") {
+		if err := e.collectScheduled("allocations", "allocations", ch, func(ch chan<- prometheus.Metric) error {
+			return e.collectAllocations(nodes, ch)
+		}); err != nil {
+			LogError(err)
+			return true
+		}
+	}
+
+	if e.toggles.enabled("peer") {
+		if err := e.collectScheduled("peer", "peers", ch, e.collectPeerMetrics); err != nil {
+			LogError(err)
+			return true
+		}
+		if err := e.collectScheduled("peer", "autopilot", ch, e.collectAutopilotMetrics); err != nil {
+			LogError(err)
+			failed = true
+		}
+		if err := e.collectScheduled("peer", "raft", ch, e.collectRaftConfiguration); err != nil {
+			LogError(err)
+			failed = true
+		}
+		if err := e.collectScheduled("peer", "members", ch, e.collectServerMembers); err != nil {
+			LogError(err)
+			failed = true
+		}
+		if err := e.collectScheduled("peer", "scheduler", ch, e.collectSchedulerConfig); err != nil {
+			LogError(err)
+			failed = true
+		}
+	}
+
+	if e.toggles.enabled("serf") {
+		if err := e.collectScheduled("serf", "self", ch, e.collectSerfMetrics); err != nil {
+			LogError(err)
+			return true
+		}
+	}
+
+	if e.toggles.enabled("jobs") {
+		if err := e.collectScheduled("jobs", "jobs", ch, e.collectJobsMetrics); err != nil {
+			LogError(err)
+			return true
+		}
+	}
+
+	if e.toggles.enabled("eval") {
+		if err := e.collectScheduled("eval", "eval", ch, e.collectEvalMetrics); err != nil {
+			LogError(err)
+			return true
+		}
+	}
+
+	if e.toggles.enabled("deployment") {
+		if err := e.collectScheduled("deployment", "deployment", ch, e.collectDeploymentMetrics); err != nil {
+			LogError(err)
+			return true
+		}
+	}
+
+	if !e.toggles.enabled("eval") || !e.toggles.enabled("deployment") {
+		if err := measure("pending", func() error {
+			return e.collectPendingWork(ch)
+		}); err != nil {
+			LogError(err)
+			failed = true
+		}
+	}
+
+	if e.toggles.enabled("broker") {
+		if err := e.collectScheduled("broker", "broker", ch, e.collectBrokerMetrics); err != nil {
+			LogError(err)
+			return true
+		}
+	}
+
+	if e.toggles.enabled("keyring") {
+		if err := e.collectScheduled("keyring", "keyring", ch, e.collectKeyringMetrics); err != nil {
+			LogError(err)
+			failed = true
+		}
+	}
+
+	if e.toggles.enabled("placement") {
+		if err := e.collectScheduled("placement", "placement", ch, func(ch chan<- prometheus.Metric) error {
+			return e.collectPlacementScores(nodes, ch)
+		}); err != nil {
+			LogError(err)
+			failed = true
+		}
+	}
+
+	if e.toggles.enabled("federation") {
+		if err := e.collectScheduled("federation", "federation", ch, e.collectRegions); err != nil {
+			LogError(err)
+			failed = true
+		}
+	}
+
+	return failed
+}
+
+func (e *Exporter) collectLeader(ch chan<- prometheus.Metric) error {
+	leader, err := e.client.Status().Leader()
+	if err != nil {
+		return fmt.Errorf("could not collect leader: %s", err)
+	}
+
+	logrus.Debugf("Leader is %s", leader)
+	if e.leaderTracker.observe(leader) {
+		raftLeaderChanges.Inc()
+	}
+	ch <- raftLeaderChanges
+
+	address := e.client.Address()
+	if e.Endpoint != nil {
+		address = e.Endpoint.Active()
+		e.Endpoint.Collect(ch)
+	}
+	logrus.Debugf("Client address is %s", address)
+
+	leaderHostname, _, err := net.SplitHostPort(leader)
+	if err != nil {
+		return fmt.Errorf("leader is not a host:port but %s: %s", leader, err)
+	}
+
+	clientHost, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("client address %s can't be parsed as a url: %s", address, err)
+	}
+
+	clientHostname := clientHost.Hostname()
+	if e.UnixSocket {
+		// the socket doesn't tell the address, the agent does
+		self, err := e.client.Agent().Self()
+		if err != nil {
+			return fmt.Errorf("could not get the agent address: %s", err)
+		}
+		clientHostname = self.Member.Addr
+	}
+
+	logrus.Debugf("Client Hostname is %s", clientHostname)
+	logrus.Debugf("Leader Hostname is %s", leaderHostname)
+
+	var isLeader float64
+	if sameHost(leaderHostname, clientHostname) {
+		isLeader = 1
+	}
+
+	e.amILeader = isLeader == 1
+
+	ch <- prometheus.MustNewConstMetric(
+		clusterLeader, prometheus.GaugeValue, isLeader,
+	)
+	return nil
+}
+
+// sameHost tells whether two hosts are the same, comparing IP addresses as
+// IPs so the bracketed, zoned and abbreviated forms of an IPv6 address match
+func sameHost(a, b string) bool {
+	a, b = bareHost(a), bareHost(b)
+	if ipA, ipB := net.ParseIP(a), net.ParseIP(b); ipA != nil && ipB != nil {
+		return ipA.Equal(ipB)
+	}
+	return strings.EqualFold(a, b)
+}
+
+// bareHost strips the brackets and the zone of an IPv6 address
+func bareHost(host string) string {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	return host
+}
+
+func (e *Exporter) collectJobsMetrics(ch chan<- prometheus.Metric) error {
+	if !e.shouldReadMetrics() {
+		return nil
+	}
+
+	jobs, stubs, err := e.listJobs()
+	if err != nil {
+		return fmt.Errorf("could not get jobs: %s", err)
+	}
+	e.snapshot.update(func(s *snapshotData) { s.Jobs = jobs })
+	logrus.Debugf("collected job metrics %d", len(jobs))
+	ch <- prometheus.MustNewConstMetric(
+		jobsTotal, prometheus.GaugeValue, float64(len(jobs)),
+	)
+	collectJobBreakdown(stubs, ch)
+	specs := e.refreshJobSpecs(stubs)
+	e.jobPool.collect(ch)
+	collectJobSpecs(stubs, specs, ch)
+
+	var dead int
+	for _, job := range jobs {
+		// periodic and parameterized jobs are only collected once stopped
+		if job.Status == "dead" && (job.Stop || (!job.Periodic && !job.ParameterizedJob)) {
+			dead++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		gcEligibleJobs, prometheus.GaugeValue, float64(dead),
+	)
+
+	for _, job := range stubs {
+		// children are covered by nomad_job_children
+		if job.ParentID != "" {
+			continue
+		}
+		for _, status := range []string{"pending", "running", "dead"} {
+			var v float64
+			if job.Status == status {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				jobStatus, prometheus.GaugeValue, v, job.ID, job.Type, job.Namespace, status,
+			)
+		}
+		if job.SubmitTime > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				jobSubmitTime, prometheus.GaugeValue, float64(job.SubmitTime)/1e9, job.ID, job.Type, job.Namespace,
+			)
+		}
+	}
+
+	for _, job := range stubs {
+		if !job.Periodic && !job.ParameterizedJob {
+			continue
+		}
+
+		if job.JobSummary != nil && job.JobSummary.Children != nil {
+			children := job.JobSummary.Children
+			ch <- prometheus.MustNewConstMetric(
+				jobChildren, prometheus.GaugeValue, float64(children.Pending), job.ID, job.Namespace, "pending")
+			ch <- prometheus.MustNewConstMetric(
+				jobChildren, prometheus.GaugeValue, float64(children.Running), job.ID, job.Namespace, "running")
+			ch <- prometheus.MustNewConstMetric(
+				jobChildren, prometheus.GaugeValue, float64(children.Dead), job.ID, job.Namespace, "dead")
+		}
+
+		if entry, ok := specs[jobKey(job.Namespace, job.ID)]; ok && job.Periodic && !job.Stop {
+			if err := collectPeriodicNextLaunch(job, entry.periodic, ch); err != nil {
+				LogError(err)
+			}
+		}
+	}
+
+	e.collectBatchJobs(stubs, ch)
+	if e.jobMeta != nil {
+		e.collectJobMeta(stubs, specs, ch)
+	}
+	return nil
+}
+
+// collectPeriodicNextLaunch exports when a periodic job launches next, the
+// job list doesn't include the periodic spec so it's read from the job
+// specification
+func collectPeriodicNextLaunch(job *jobListStub, p *api.PeriodicConfig, ch chan<- prometheus.Metric) error {
+	if p == nil || p.Spec == nil || p.SpecType == nil || (p.Enabled != nil && !*p.Enabled) {
+		return nil
+	}
+	location, err := p.GetLocation()
+	if err != nil {
+		return fmt.Errorf("invalid time zone for periodic job %s of namespace %s: %s", job.ID, job.Namespace, err)
+	}
+	next, err := p.Next(time.Now().In(location))
+	if err != nil {
+		return fmt.Errorf("could not compute next launch of periodic job %s of namespace %s: %s", job.ID, job.Namespace, err)
+	}
+	if next.IsZero() {
+		return nil
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		jobPeriodicNextLaunch, prometheus.GaugeValue, float64(next.Unix()), job.ID, job.Namespace,
+	)
+	return nil
+}
+
+func (e *Exporter) collectNodes(nodes nodeMap, ch chan<- prometheus.Metric) error {
+	ch <- prometheus.MustNewConstMetric(
+		serfLanMembers, prometheus.GaugeValue, float64(len(nodes)),
+	)
+	logrus.Debugf("I've the nodes list with %d nodes", len(nodes))
+
+	if !e.shouldReadMetrics() {
+		return nil
+	}
+
+	for _, node := range e.nodeEligibility.observe(nodes) {
+		e.notify(EventNodeIneligible, node.ID, map[string]string{
+			"node":       node.Name,
+			"datacenter": node.Datacenter,
+			"class":      node.NodeClass,
+			"drain":      strconv.FormatBool(node.Drain),
+		})
+	}
+
+	e.snapshot.update(func(s *snapshotData) {
+		for _, node := range nodes {
+			s.Nodes = append(s.Nodes, node)
+		}
+		sort.Slice(s.Nodes, func(i, j int) bool { return s.Nodes[i].ID < s.Nodes[j].ID })
+	})
+
+	var allocated nodeAllocated
+	if e.toggles.enabled("allocation-stats") {
+		o := newLatencyObserver("get_allocated")
+		var err error
+		allocated, err = e.listAllocated()
+		o.observe()
+		if err != nil {
+			LogError(err)
+		}
+	}
+
+	region, err := e.region()
+	if err != nil {
+		LogError(err)
+	}
+	totals := newDatacenterTotals(region, e.toggles.enabled("allocation-stats"))
+	var jobCosts *labeledCounts
+	if e.Costs != nil {
+		jobCosts = newLabeledCounts(jobCost)
+	}
+	var w sync.WaitGroup
+	for _, node := range nodes {
+		e.nodePool.Go(&w, func(node api.NodeListStub) func() {
+			return func() {
+				state := 1
+				drain := strconv.FormatBool(node.Drain)
+				totals.addNode(node.Datacenter, node.Status)
+
+				ch <- prometheus.MustNewConstMetric(
+					nodeInfo, prometheus.GaugeValue, 1,
+					node.NodeClass, node.Datacenter, drain, node.Name,
+					node.ID, node.SchedulingEligibility, node.Status, node.Version,
+				)
+				ch <- prometheus.MustNewConstMetric(
+					nodeEligible, prometheus.GaugeValue,
+					boolToFloat(node.SchedulingEligibility == api.NodeSchedulingEligible),
+					node.Name, node.Datacenter, node.NodeClass,
+				)
+
+				if !nodes.IsReady(node.ID) {
+					state = 0
+				}
+				ch <- prometheus.MustNewConstMetric(
+					serfLanMembersStatus, prometheus.GaugeValue, float64(state),
+					node.NodeClass, node.Datacenter, node.Name, node.ID, drain,
+				)
+				ch <- prometheus.MustNewConstMetric(
+					nodeStatusInfo, prometheus.GaugeValue, 1,
+					node.Name, node.ID, node.Status, node.StatusDescription,
+				)
+
+				// down nodes are fetched too for their events and cost, the
+				// cache keeps them until their status changes again. Nodes
+				// whose circuit is open are only read from the cache
+				open := !e.nodeCircuits.allow(node.ID)
+				n, ok := e.nodeCache.get(node)
+				if !ok {
+					if open {
+						logrus.Debugf("Skipping node %s because its circuit is open", node.Name)
+						return
+					}
+					var err error
+					if n, err = e.nodeInfo(node); err != nil {
+						e.nodeCircuits.record(node.ID, node.Name, err)
+						LogError(err)
+						return
+					}
+				}
+				collectNodeStatusChange(n, ch)
+				e.collectNodeCost(n, ch)
+
+				if !nodes.IsReady(node.ID) {
+					logrus.Debugf("Skipping node information and allocations %s because it is %s", node.Name, node.Status)
+					return
+				}
+
+				if !validVersion(node.Name, node.Version) {
+					return
+				}
+
+				// only the reserved ports fail to parse, they're logged
+				// along with the node resources
+				reserved, _ := reservedResources(n)
+				totals.addCapacity(n.Datacenter, datacenterCapacity{
+					allocatableCPU:    float64(*n.Resources.CPU - reserved.CPU),
+					allocatableMemory: float64(*n.Resources.MemoryMB-reserved.MemoryMB) * 1024 * 1024,
+				})
+
+				if !e.toggles.enabled("allocation-stats") {
+					return
+				}
+
+				if open {
+					logrus.Debugf("Skipping node %s because its circuit is open", node.Name)
+					return
+				}
+
+				err := e.collectNodeResources(n, allocated, totals, jobCosts, ch)
+				e.nodeCircuits.record(node.ID, node.Name, err)
+				if err != nil {
+					LogError(err)
+				}
+			}
+		}(*node))
+	}
+
+	w.Wait()
+	totals.collect(ch)
+	if jobCosts != nil {
+		jobCosts.collect(ch)
+	}
+	e.nodeCache.prune(nodes)
+	e.nodeCircuits.prune(nodes)
+	e.nodePool.collect(ch)
+	e.nodeCircuits.collect(ch)
+
+	logrus.Debugf("done waiting for node metrics")
+	return nil
+}
+
+// collectNodeResources collects the resources and usage of a ready node
+func (e *Exporter) collectNodeResources(n *api.Node, allocated nodeAllocated, totals *datacenterTotals, jobCosts *labeledCounts, ch chan<- prometheus.Metric) error {
+	nodeTotals, err := e.nodeAllocatedTotals(n, allocated)
+	if err != nil {
+		return err
+	}
+	allocatedCPU, allocatedMemory := nodeTotals.cpu, nodeTotals.memoryMB
+
+	nodeLabels := []string{n.Name, n.Datacenter}
+	ch <- prometheus.MustNewConstMetric(
+		nodeResourceMemory, prometheus.GaugeValue, float64(*n.Resources.MemoryMB)*1024*1024,
+		nodeLabels...,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		nodeAllocatedMemory, prometheus.GaugeValue, float64(allocatedMemory)*1024*1024,
+		nodeLabels...,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		nodeAllocatedCPU, prometheus.GaugeValue, float64(allocatedCPU),
+		nodeLabels...,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		nodeResourceCPU, prometheus.GaugeValue, float64(*n.Resources.CPU),
+		nodeLabels...,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		nodeResourceIOPS, prometheus.GaugeValue, float64(*n.Resources.IOPS),
+		nodeLabels...,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		nodeResourceDiskBytes, prometheus.GaugeValue, float64(*n.Resources.DiskMB)*1024*1024,
+		nodeLabels...,
+	)
+
+	reserved, err := reservedResources(n)
+	if err != nil {
+		LogError(err)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		nodeReservedCPU, prometheus.GaugeValue, float64(reserved.CPU),
+		nodeLabels...,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		nodeReservedMemory, prometheus.GaugeValue, float64(reserved.MemoryMB)*1024*1024,
+		nodeLabels...,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		nodeReservedDiskBytes, prometheus.GaugeValue, float64(reserved.DiskMB)*1024*1024,
+		nodeLabels...,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		nodeReservedPorts, prometheus.GaugeValue, float64(reserved.Ports),
+		nodeLabels...,
+	)
+	oversubscribed := nodeTotals.memoryMaxMB - (*n.Resources.MemoryMB - reserved.MemoryMB)
+	if oversubscribed < 0 {
+		oversubscribed = 0
+	}
+	ch <- prometheus.MustNewConstMetric(
+		nodeMemoryOversubscribed, prometheus.GaugeValue, float64(oversubscribed)*1024*1024,
+		nodeLabels...,
+	)
+	// there are no job costs in client mode
+	if jobCosts != nil {
+		allocatable := allocatedTotals{
+			cpu:      *n.Resources.CPU - reserved.CPU,
+			memoryMB: *n.Resources.MemoryMB - reserved.MemoryMB,
+		}
+		e.addJobCosts(n, allocatable, nodeTotals, jobCosts)
+	}
+	// there are no datacenter totals in client mode
+	if totals != nil {
+		totals.addCapacity(n.Datacenter, datacenterCapacity{
+			allocatedCPU:    float64(allocatedCPU),
+			allocatedMemory: float64(allocatedMemory) * 1024 * 1024,
+		})
+	}
+
+	o := newNodeLatencyObserver(n.Name, "get_stats")
+	nodeStats, err := e.client.Nodes().Stats(n.ID, e.queryOptions("nodes"))
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("failed to get node %s stats: %s", n.Name, err)
+	}
+	logrus.Debugf("Fetched node %s stats", n.Name)
+
+	ch <- prometheus.MustNewConstMetric(
+		nodeUsedMemory, prometheus.GaugeValue, float64(nodeStats.Memory.Used),
+		nodeLabels...,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		nodeUsedCPU, prometheus.GaugeValue, float64(math.Floor(nodeStats.CPUTicksConsumed)),
+		nodeLabels...,
+	)
+
+	if m := nodeStats.Memory; m != nil {
+		for state, value := range map[string]uint64{
+			"total":     m.Total,
+			"available": m.Available,
+			"used":      m.Used,
+			"free":      m.Free,
+		} {
+			ch <- prometheus.MustNewConstMetric(
+				nodeMemoryBytes, prometheus.GaugeValue, float64(value),
+				append(nodeLabels, state)...,
+			)
+		}
+	}
+
+	for _, disk := range nodeStats.DiskStats {
+		diskLabels := append(nodeLabels, disk.Device, disk.Mountpoint)
+		ch <- prometheus.MustNewConstMetric(
+			nodeDiskSizeBytes, prometheus.GaugeValue, float64(disk.Size), diskLabels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			nodeDiskUsedBytes, prometheus.GaugeValue, float64(disk.Used), diskLabels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			nodeDiskAvailableBytes, prometheus.GaugeValue, float64(disk.Available), diskLabels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			nodeDiskInodesUsedPercent, prometheus.GaugeValue, disk.InodesUsedPercent, diskLabels...,
+		)
+	}
+
+	if e.PerCPUMetrics {
+		for _, cpu := range nodeStats.CPU {
+			for mode, value := range map[string]float64{
+				"user":   cpu.User,
+				"system": cpu.System,
+				"idle":   cpu.Idle,
+			} {
+				ch <- prometheus.MustNewConstMetric(
+					nodeCPUPercent, prometheus.GaugeValue, value,
+					append(nodeLabels, cpu.CPU, mode)...,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) getRunningAllocs(nodeID string) ([]*api.Allocation, error) {
+	var allocs []*api.Allocation
+
+	// Query the node allocations
+	var nodeAllocs []*api.Allocation
+	err := e.queryAllocations("/v1/node/"+nodeID+"/allocations", &nodeAllocs, e.queryOptions("nodes"))
+
+	// Filter list to only running allocations
+	for _, alloc := range nodeAllocs {
+		if alloc.ClientStatus == "running" {
+			allocs = append(allocs, alloc)
+		}
+	}
+	return allocs, err
+}
+
+func (e *Exporter) collectPeerMetrics(ch chan<- prometheus.Metric) error {
+	if !e.shouldReadMetrics() {
+		return nil
+	}
+
+	peers, err := e.client.Status().Peers()
+	if err != nil {
+		return fmt.Errorf("failed to get peer metrics: %s", err)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		clusterServers, prometheus.GaugeValue, float64(len(peers)),
+	)
+	return nil
+}
+
+// collectServerMembers exports the status of every server in the gossip pool,
+// failed ones included, and the version it advertises, to follow upgrades
+// through mixed version clusters
+func (e *Exporter) collectServerMembers(ch chan<- prometheus.Metric) error {
+	o := newLatencyObserver("get_agent_members")
+	members, err := e.client.Agent().Members()
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("failed to get server members: %s", err)
+	}
+	for _, m := range members.Members {
+		ch <- prometheus.MustNewConstMetric(
+			serverVersion, prometheus.GaugeValue, 1,
+			m.Name, m.Tags["region"], m.Tags["dc"], m.Tags["build"],
+		)
+		for _, status := range []string{"alive", "leaving", "left", "failed"} {
+			var v float64
+			if m.Status == status {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				serverMemberStatus, prometheus.GaugeValue, v,
+				m.Name, m.Tags["region"], m.Tags["dc"], status,
+			)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			serverMemberProtocol, prometheus.GaugeValue, float64(m.ProtocolCur),
+			m.Name, m.Tags["region"], m.Tags["dc"], "serf",
+		)
+		ch <- prometheus.MustNewConstMetric(
+			serverMemberProtocol, prometheus.GaugeValue, float64(m.DelegateCur),
+			m.Name, m.Tags["region"], m.Tags["dc"], "delegate",
+		)
+	}
+	return nil
+}
+
+func (e *Exporter) collectSerfMetrics(ch chan<- prometheus.Metric) error {
+	self, err := e.client.Agent().Self()
+	if err != nil {
+		return fmt.Errorf("failed to get self metrics: %s", err)
+	}
+
+	if amIServer, err := strconv.ParseBool(self.Stats["nomad"]["server"]); err == nil && !amIServer {
+		return fmt.Errorf("I am not a server")
+	}
+	raft := self.Stats["raft"]
+	datacenter, err := e.client.Agent().Datacenter()
+	if err != nil {
+		return fmt.Errorf("unable to fetch the datacenter")
+	}
+	nodeName, err := e.client.Agent().NodeName()
+	if err != nil {
+		return fmt.Errorf("unable to fetch the node name")
+	}
+	appliedIndex, err := strconv.ParseFloat(raft["applied_index"], 64)
+	if err == nil {
+		ch <- prometheus.MustNewConstMetric(
+			raftAppliedIndex, prometheus.GaugeValue, appliedIndex,
+			datacenter, nodeName,
+		)
+	}
+
+	commitIndex, err := strconv.ParseFloat(raft["commit_index"], 64)
+	if err == nil {
+		ch <- prometheus.MustNewConstMetric(
+			raftCommitIndex, prometheus.GaugeValue, commitIndex,
+			datacenter, nodeName,
+		)
+	}
+
+	lastLogIndex, err := strconv.ParseFloat(raft["last_log_index"], 64)
+	if err == nil {
+		ch <- prometheus.MustNewConstMetric(
+			raftLastLogIndex, prometheus.GaugeValue, lastLogIndex,
+			datacenter, nodeName,
+		)
+	}
+
+	fsmPending, err := strconv.ParseFloat(raft["fsm_pending"], 64)
+	if err == nil {
+		ch <- prometheus.MustNewConstMetric(
+			raftFsmPending, prometheus.GaugeValue, fsmPending,
+			datacenter, nodeName,
+		)
+	}
+
+	lastSnapshotIndex, err := strconv.ParseFloat(raft["last_snapshot_index"], 64)
+	if err == nil {
+		ch <- prometheus.MustNewConstMetric(
+			raftLastSnapshotIndex, prometheus.GaugeValue, lastSnapshotIndex,
+			datacenter, nodeName,
+		)
+	}
+
+	numPeers, err := strconv.ParseFloat(raft["num_peers"], 64)
+	if err == nil {
+		ch <- prometheus.MustNewConstMetric(
+			raftNumPeers, prometheus.GaugeValue, numPeers,
+			datacenter, nodeName,
+		)
+	}
+	return nil
+}
+
+func (e *Exporter) collectAllocations(nodes nodeMap, ch chan<- prometheus.Metric) error {
+	if !e.shouldReadMetrics() {
+		return nil
+	}
+
+	o := newLatencyObserver("get_allocations")
+	allocStubs, err := e.listAllocations()
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("could not get allocations: %s", err)
+	}
+	e.snapshot.update(func(s *snapshotData) { s.Allocations = allocStubs })
+
+	e.allocationFailures.observe(allocStubs)
+	allocationsFailed.Collect(ch)
+
+	// the per allocation series are left out when the stats are aggregated
+	perAlloc := e.AllocationAggregation == AggregationAlloc
+	var usages *groupUsages
+	var top *topAllocations
+	switch e.AllocationAggregation {
+	case AggregationJob:
+		usages = newGroupUsages()
+	case AggregationTopK:
+		top = newTopAllocations(e.AllocationTopK)
+	}
+
+	allocations := newLabeledCounts(allocation)
+	tasks := newLabeledCounts(taskCount)
+	pendingStale := newLabeledCounts(allocationPendingStale)
+	zombieCounts := newLabeledCounts(zombieAllocations)
+
+	var w sync.WaitGroup
+
+	var zombies []zombieAllocation
+	var terminal int
+	now := time.Now()
+	for _, allocStub := range allocStubs {
+		if allocTerminal(allocStub) {
+			terminal++
+		} else if d := allocStub.DeploymentStatus; perAlloc && d != nil && d.Healthy != nil {
+			ch <- prometheus.MustNewConstMetric(
+				allocationDeploymentHealthy, prometheus.GaugeValue, boolToFloat(*d.Healthy),
+				allocStub.JobID, allocStub.TaskGroup, allocStub.ID, strconv.FormatBool(d.Canary),
+			)
+		}
+
+		n := nodes[allocStub.NodeID]
+		if n == nil {
+			logrus.Debugf("Allocation %s doesn't have a node associated. Skipping",
+				allocStub.ID)
+			zombieCounts.add(1, allocStub.JobID, allocStub.NodeID, allocStub.DesiredStatus)
+			zombies = append(zombies, zombieAllocation{
+				ID:            allocStub.ID,
+				JobID:         allocStub.JobID,
+				NodeID:        allocStub.NodeID,
+				DesiredStatus: allocStub.DesiredStatus,
+				ClientStatus:  allocStub.ClientStatus,
+			})
+			continue
+		}
+
+		if allocStub.ClientStatus == "pending" && now.Sub(time.Unix(0, allocStub.CreateTime)) > e.PendingThreshold {
+			pendingStale.add(1, allocStub.JobID, n.Name)
+		}
+
+		allocStub, n := *allocStub, n
+		e.allocationPool.Go(&w, func() {
+			if !nodes.IsReady(allocStub.NodeID) {
+				logrus.Debugf("Skipping fetching allocation %s for node %s because it's not in ready state but %s",
+					allocStub.Name, n.Name, n.Status)
+				return
+			}
+			if !validVersion(n.Name, n.Version) {
+				logrus.Debugf("Skipping fetching allocation %s for node %s because it's not a supported version but %s",
+					allocStub.Name, n.Name, n.Version)
+				return
+			}
+			if allocStub.DesiredStatus != "run" && !e.recentTerminal(&allocStub, now) {
+				logrus.Debugf("Skipping fetching allocation %s because it's not desired to be run",
+					allocStub.Name)
+				return
+			}
+			alloc, err := e.allocationInfo(allocStub)
+			if err != nil {
+				LogError(err)
+				return
+			}
+
+			job := alloc.Job
+
+			allocations.add(1,
+				alloc.ClientStatus, *job.Type, alloc.JobID,
+				fmt.Sprintf("%d", *alloc.Job.Version), alloc.TaskGroup, n.Name,
+			)
+
+			if perAlloc {
+				e.collectAllocationTimestamps(alloc, n.Datacenter, n.Name, ch)
+				e.collectTaskExits(alloc, n.Datacenter, n.Name, ch)
+			}
+
+			taskStates := alloc.TaskStates
+
+			kinds := e.taskKinds(alloc)
+			for taskName, task := range taskStates {
+				kind := kinds[taskName]
+				tasks.add(1, task.State, *job.Type, n.Name, kind.driver, kind.lifecycle)
+			}
+
+			// Return unless the allocation is running
+			if allocStub.ClientStatus != "running" {
+				return
+			}
+
+			if e.AllocationPortMetrics {
+				e.collectAllocationPorts(alloc, n.Datacenter, n.Name, ch)
+			}
+
+			if !e.toggles.enabled("allocation-stats") {
+				return
+			}
+
+			if !e.nodeCircuits.allow(allocStub.NodeID) {
+				logrus.Debugf("Skipping allocation %s stats because the circuit of node %s is open",
+					allocStub.Name, n.Name)
+				return
+			}
+			e.allocationStatsPool.Go(&w, func() {
+				if usages != nil {
+					if err := e.aggregateAllocationStats(usages, alloc, n.Datacenter, n.Name); err != nil {
+						LogError(err)
+					}
+					return
+				}
+				if top != nil {
+					if err := e.rankAllocationStats(top, alloc, n.Datacenter, n.Name); err != nil {
+						LogError(err)
+					}
+					return
+				}
+				if err := e.collectAllocationStats(alloc, n.Datacenter, n.Name, ch); err != nil {
+					LogError(err)
+				}
+			})
+		})
+	}
+
+	w.Wait()
+	e.allocationJobs.prune()
+	e.allocationPool.collect(ch)
+	e.allocationStatsPool.collect(ch)
+	if usages != nil {
+		usages.collect(ch)
+	}
+	if top != nil {
+		e.collectTopAllocations(top, ch)
+	}
+	for _, zombie := range e.zombies.set(zombies) {
+		e.notify(EventZombieAllocation, zombie.ID, map[string]string{
+			"job_id":         zombie.JobID,
+			"node_id":        zombie.NodeID,
+			"desired_status": zombie.DesiredStatus,
+			"client_status":  zombie.ClientStatus,
+		})
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		gcEligibleAllocations, prometheus.GaugeValue, float64(terminal),
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		allocationZombies, prometheus.GaugeValue, float64(len(zombies)),
+	)
+
+	allocations.collect(ch)
+	tasks.collect(ch)
+	pendingStale.collect(ch)
+	zombieCounts.collect(ch)
+	return nil
+}
+
+// collectAllocationStats collects the resource usage of a running allocation
+func (e *Exporter) collectAllocationStats(alloc *api.Allocation, datacenter, nodeName string, ch chan<- prometheus.Metric) error {
+	stats, err := e.allocationStats(nodeName, alloc)
+	if err != nil {
+		return err
+	}
+	e.exportAllocationStats(alloc, stats, datacenter, nodeName, ch)
+	return nil
+}
+
+// exportAllocationStats exports the stats of the allocation and its tasks
+func (e *Exporter) exportAllocationStats(alloc *api.Allocation, stats *api.AllocResourceUsage, datacenter, nodeName string, ch chan<- prometheus.Metric) {
+	allocationLabels := allocationLabels(alloc, datacenter, nodeName)
+	ch <- prometheus.MustNewConstMetric(
+		allocationCPUPercent, prometheus.GaugeValue, stats.ResourceUsage.CpuStats.Percent, allocationLabels...,
+	)
+	ch <- e.cumulativeMetric(
+		allocationCPUThrottled, allocationCPUThrottledTotal, float64(stats.ResourceUsage.CpuStats.ThrottledTime), allocationLabels...,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		allocationMemoryBytes, prometheus.GaugeValue, float64(stats.ResourceUsage.MemoryStats.RSS), allocationLabels...,
+	)
+	for stat, value := range memoryStats(stats.ResourceUsage.MemoryStats) {
+		ch <- prometheus.MustNewConstMetric(
+			allocationMemoryStatBytes, prometheus.GaugeValue, value, append(allocationLabels, stat)...,
+		)
+	}
+	ch <- e.cumulativeMetric(
+		allocationCPUTicks, allocationCPUTicksTotal, float64(stats.ResourceUsage.CpuStats.TotalTicks), allocationLabels...,
+	)
+	ch <- e.cumulativeMetric(
+		allocationCPUUserMode, allocationCPUUserModeTotal, float64(stats.ResourceUsage.CpuStats.UserMode), allocationLabels...,
+	)
+	ch <- e.cumulativeMetric(
+		allocationCPUSystemMode, allocationCPUSystemModeTotal, float64(stats.ResourceUsage.CpuStats.SystemMode), allocationLabels...,
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		allocationMemoryBytesRequired, prometheus.GaugeValue, float64(*alloc.Resources.MemoryMB)*1024*1024, allocationLabels...,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		allocationCPURequired, prometheus.GaugeValue, float64(*alloc.Resources.CPU), allocationLabels...,
+	)
+
+	kinds := e.taskKinds(alloc)
+	for taskName, taskStats := range stats.Tasks {
+		kind := kinds[taskName]
+		taskLabels := append(allocationLabels, taskName, kind.driver, kind.lifecycle)
+		ch <- prometheus.MustNewConstMetric(
+			taskCPUPercent, prometheus.GaugeValue, taskStats.ResourceUsage.CpuStats.Percent, taskLabels...,
+		)
+		ch <- e.cumulativeMetric(
+			taskCPUTotalTicks, taskCPUTicksTotal, taskStats.ResourceUsage.CpuStats.TotalTicks, taskLabels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			taskMemoryRssBytes, prometheus.GaugeValue, float64(taskStats.ResourceUsage.MemoryStats.RSS), taskLabels...,
+		)
+		for stat, value := range memoryStats(taskStats.ResourceUsage.MemoryStats) {
+			ch <- prometheus.MustNewConstMetric(
+				taskMemoryStatBytes, prometheus.GaugeValue, value, append(taskLabels, stat)...,
+			)
+		}
+	}
+}
+
+// collectAllocationTimestamps collects when the allocation was created and
+// last modified, and when its tasks started and finished
+func (e *Exporter) collectAllocationTimestamps(alloc *api.Allocation, datacenter, nodeName string, ch chan<- prometheus.Metric) {
+	allocationLabels := allocationLabels(alloc, datacenter, nodeName)
+	ch <- prometheus.MustNewConstMetric(
+		allocationCreateTimestamp, prometheus.GaugeValue, float64(alloc.CreateTime)/1e9, allocationLabels...,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		allocationModifyTimestamp, prometheus.GaugeValue, float64(alloc.ModifyTime)/1e9, allocationLabels...,
+	)
+
+	kinds := e.taskKinds(alloc)
+	for taskName, task := range alloc.TaskStates {
+		kind := kinds[taskName]
+		taskLabels := append(allocationLabels, taskName, kind.driver, kind.lifecycle)
+		if !task.StartedAt.IsZero() {
+			ch <- prometheus.MustNewConstMetric(
+				taskStartedTimestamp, prometheus.GaugeValue, float64(task.StartedAt.UnixNano())/1e9, taskLabels...,
+			)
+		}
+		if !task.FinishedAt.IsZero() {
+			ch <- prometheus.MustNewConstMetric(
+				taskFinishedTimestamp, prometheus.GaugeValue, float64(task.FinishedAt.UnixNano())/1e9, taskLabels...,
+			)
+		}
+	}
+}
+
+// collectTaskExits collects how the tasks of the allocation last exited,
+// from their last terminated event. Nomad keeps the last 10 events of a
+// task, a task that exited longer ago isn't exported
+func (e *Exporter) collectTaskExits(alloc *api.Allocation, datacenter, nodeName string, ch chan<- prometheus.Metric) {
+	allocationLabels := allocationLabels(alloc, datacenter, nodeName)
+	kinds := e.taskKinds(alloc)
+	for taskName, task := range alloc.TaskStates {
+		var last *api.TaskEvent
+		for _, event := range task.Events {
+			if event.Type == api.TaskTerminated && (last == nil || event.Time >= last.Time) {
+				last = event
+			}
+		}
+		if last == nil {
+			continue
+		}
+
+		kind := kinds[taskName]
+		taskLabels := append(allocationLabels, taskName, kind.driver, kind.lifecycle)
+		ch <- prometheus.MustNewConstMetric(
+			taskLastExitCode, prometheus.GaugeValue, float64(last.ExitCode), taskLabels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			taskLastExitSignal, prometheus.GaugeValue, float64(last.Signal), taskLabels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			taskLastExitOOMKilled, prometheus.GaugeValue, boolToFloat(last.Details["oom_killed"] == "true"), taskLabels...,
+		)
+	}
+}
+
+// recentTerminal tells whether the terminal allocation is counted, when the
+// terminal allocations are included and it stopped within the lookback
+func (e *Exporter) recentTerminal(alloc *api.AllocationListStub, now time.Time) bool {
+	return e.IncludeTerminalAllocations && allocTerminal(alloc) &&
+		now.Sub(time.Unix(0, alloc.ModifyTime)) <= e.TerminalLookback
+}
+
+// allocTerminal tells whether the allocation is terminal, as nomad does to
+// decide whether it can be garbage collected
+func allocTerminal(alloc *api.AllocationListStub) bool {
+	switch alloc.DesiredStatus {
+	case "stop", "evict":
+		return true
+	}
+	switch alloc.ClientStatus {
+	case "complete", "failed", "lost":
+		return true
+	}
+	return false
+}
+
+// memoryStats returns the memory stats beyond RSS the driver measures, all
+// of them when it doesn't tell
+func memoryStats(m *api.MemoryStats) map[string]float64 {
+	stats := map[string]float64{}
+	if m == nil {
+		return stats
+	}
+
+	all := map[string]struct {
+		stat  string
+		value uint64
+	}{
+		"Cache":            {"cache", m.Cache},
+		"Swap":             {"swap", m.Swap},
+		"Usage":            {"usage", m.Usage},
+		"Max Usage":        {"max_usage", m.MaxUsage},
+		"Kernel Usage":     {"kernel_usage", m.KernelUsage},
+		"Kernel Max Usage": {"kernel_max_usage", m.KernelMaxUsage},
+	}
+	if len(m.Measured) == 0 {
+		for _, s := range all {
+			stats[s.stat] = float64(s.value)
+		}
+		return stats
+	}
+	for _, measured := range m.Measured {
+		if s, ok := all[measured]; ok {
+			stats[s.stat] = float64(s.value)
+		}
+	}
+	return stats
+}
+
+// collectAllocationPorts collects an info metric for every port allocated to
+// the tasks of the allocation, with the host ip it's reachable at
+func (e *Exporter) collectAllocationPorts(alloc *api.Allocation, datacenter, nodeName string, ch chan<- prometheus.Metric) {
+	if alloc.AllocatedResources == nil {
+		return
+	}
+
+	allocationLabels := allocationLabels(alloc, datacenter, nodeName)
+	for taskName, task := range alloc.AllocatedResources.Tasks {
+		for _, network := range task.Networks {
+			ports := append(append([]api.Port{}, network.ReservedPorts...), network.DynamicPorts...)
+			for _, port := range ports {
+				ch <- prometheus.MustNewConstMetric(
+					allocationPortInfo, prometheus.GaugeValue, 1,
+					append(allocationLabels, taskName, port.Label, network.IP, strconv.Itoa(port.Value))...,
+				)
+			}
+		}
+	}
+}
+
+func allocationLabels(alloc *api.Allocation, datacenter, nodeName string) []string {
+	return []string{
+		*alloc.Job.Name,
+		fmt.Sprintf("%d", *alloc.Job.Version),
+		alloc.TaskGroup,
+		alloc.Name,
+		*alloc.Job.Region,
+		datacenter,
+		nodeName,
+	}
+}
+
+// allocationStats returns the cached stats for local allocations, querying
+// the api otherwise
+func (e *Exporter) allocationStats(nodeName string, alloc *api.Allocation) (*api.AllocResourceUsage, error) {
+	if e.localStats != nil {
+		if stats, ok := e.localStats.Get(alloc.NodeID, alloc.ID); ok {
+			return stats, nil
+		}
+	}
+
+	no := newNodeLatencyObserver(nodeName, "get_allocation_stats")
+	stats, err := e.client.Allocations().Stats(alloc, e.queryOptions("allocations"))
+	no.observe()
+	return stats, err
+}
+
+func (e *Exporter) collectEvalMetrics(ch chan<- prometheus.Metric) error {
+	if !e.shouldReadMetrics() {
+		return nil
+	}
+
+	evals, err := e.listEvaluations()
+	if err != nil {
+		return fmt.Errorf("could not get evaluation metrics: %s", err)
+	}
+
+	e.evalLatencies.observe(evals)
+	evalWaitSeconds.Collect(ch)
+	evalProcessingSeconds.Collect(ch)
+	e.collectBlockedEvals(evals, ch)
+
+	counts := newLabeledCounts(evalCount)
+	var terminal, pending int
+	for _, eval := range evals {
+		counts.add(1, eval.Status)
+
+		switch eval.Status {
+		case "complete", "failed", "canceled":
+			terminal++
+		case "pending":
+			pending++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		gcEligibleEvals, prometheus.GaugeValue, float64(terminal),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		evalsPending, prometheus.GaugeValue, float64(pending),
+	)
+
+	counts.collect(ch)
+
+	return nil
+}
+
+func (e *Exporter) collectDeploymentMetrics(ch chan<- prometheus.Metric) error {
+	if !e.shouldReadMetrics() {
+		return nil
+	}
+
+	deployments, err := e.listDeployments()
+	if err != nil {
+		return err
+	}
+	e.snapshot.update(func(s *snapshotData) { s.Deployments = deployments })
+
+	for _, dep := range e.deploymentTransitions.observe(deployments) {
+		e.notify(EventDeploymentFailed, dep.ID, map[string]string{
+			"job_id":             dep.JobID,
+			"job_version":        strconv.FormatUint(dep.JobVersion, 10),
+			"status_description": dep.StatusDescription,
+		})
+	}
+	deploymentFailed.Collect(ch)
+	deploymentAutoReverted.Collect(ch)
+	ch <- prometheus.MustNewConstMetric(
+		deploymentsActive, prometheus.GaugeValue, float64(countActive(deployments)),
+	)
+
+	counts := newLabeledCounts(deploymentCount)
+	desiredCanaries := newLabeledCounts(deploymentTaskGroupDesiredCanaries)
+	desiredTotal := newLabeledCounts(deploymentTaskGroupDesiredTotal)
+	placedAllocs := newLabeledCounts(deploymentTaskGroupPlacedAllocs)
+	healthyAllocs := newLabeledCounts(deploymentTaskGroupHealthyAllocs)
+	unhealthyAllocs := newLabeledCounts(deploymentTaskGroupUnhealthyAllocs)
+	for _, dep := range deployments {
+		taskGroups := dep.TaskGroups
+
+		counts.add(1, dep.Status, dep.JobID, fmt.Sprintf("%d", dep.JobVersion))
+
+		for taskGroupName, taskGroup := range taskGroups {
+			deploymentLabels := []string{
+				dep.Status,
+				dep.JobID,
+				fmt.Sprintf("%d", dep.JobVersion),
+				taskGroupName,
+				strconv.FormatBool(taskGroup.Promoted),
+				strconv.FormatBool(taskGroup.AutoRevert),
+			}
+
+			desiredCanaries.set(float64(taskGroup.DesiredCanaries), deploymentLabels...)
+			desiredTotal.set(float64(taskGroup.DesiredTotal), deploymentLabels...)
+			placedAllocs.set(float64(taskGroup.PlacedAllocs), deploymentLabels...)
+			healthyAllocs.set(float64(taskGroup.HealthyAllocs), deploymentLabels...)
+			unhealthyAllocs.set(float64(taskGroup.UnhealthyAllocs), deploymentLabels...)
+		}
+	}
+
+	counts.collect(ch)
+	desiredCanaries.collect(ch)
+	desiredTotal.collect(ch)
+	placedAllocs.collect(ch)
+	healthyAllocs.collect(ch)
+	unhealthyAllocs.collect(ch)
+
+	return nil
+}
+
+func (e *Exporter) fetchNodes() (nodeMap, error) {
+	o := newLatencyObserver("fetch_nodes")
+	nodes, _, err := e.client.Nodes().List(e.queryOptions("nodes"))
+	o.observe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes list: %s", err)
+	}
+
+	m := make(map[string]*api.NodeListStub)
+	for _, n := range nodes {
+		m[n.ID] = n
+	}
+	return m, nil
+}
+
+// Probe checks that the service can talk to the nomad server, and that its
+// token can read the nodes as every collector needs to. Only the nodes of a
+// prefix no node id is likely to have are listed, to keep it cheap. It
+// queries through the shared client, a collection aborted meanwhile doesn't
+// cancel it
+func (e *Exporter) Probe() error {
+	_, err := e.sharedClient.Status().Leader()
+	if err != nil {
+		return fmt.Errorf("could not collect leader: %s", err)
+	}
+	if _, _, err := e.sharedClient.Nodes().PrefixList("0000"); err != nil {
+		return fmt.Errorf("could not list nodes: %s", err)
+	}
+	return nil
+}
+
+// unauthorized matches the errors of the requests nomad denied
+var unauthorized = regexp.MustCompile(`Unexpected response code: 40[13]\b`)
+
+// IsUnauthorized tells whether nomad denied the request for lack of a valid
+// token or of permissions
+func IsUnauthorized(err error) bool {
+	return err != nil && unauthorized.MatchString(err.Error())
+}
+
+type nodeMap map[string]*api.NodeListStub
+
+func (n nodeMap) IsReady(id string) bool {
+	node, ok := n[id]
+	if !ok {
+		return false
+	}
+	return node.Status == "ready"
+}
+
+type nodeList struct {
+	nodes    nodeMap
+	nodeInfo map[string]*api.Node
+}
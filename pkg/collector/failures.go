@@ -0,0 +1,33 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// allocationFailures remembers the client statuses of the allocations
+// between collections to count the allocations that failed since
+type allocationFailures struct {
+	mu     sync.Mutex
+	status map[string]string
+}
+
+// observe counts the allocations that became failed since the last call,
+// new allocations that are failed already included. The first call only
+// records the current statuses
+func (f *allocationFailures) observe(allocs []*api.AllocationListStub) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status := make(map[string]string, len(allocs))
+	for _, alloc := range allocs {
+		status[alloc.ID] = alloc.ClientStatus
+
+		if f.status == nil || alloc.ClientStatus != "failed" || f.status[alloc.ID] == "failed" {
+			continue
+		}
+		allocationsFailed.WithLabelValues(alloc.JobID, alloc.TaskGroup).Inc()
+	}
+	f.status = status
+}
@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// regionNode is the part of a node the federation metrics decode
+type regionNode struct {
+	Datacenter string
+	Status     string
+}
+
+// regionJob is the part of a job the federation metrics decode
+type regionJob struct {
+	Type   string
+	Status string
+}
+
+// collectRegions collects the nodes and jobs of the federated regions, the
+// servers of the connected region forward the queries to the others. A region
+// that doesn't answer is reported down without failing the others
+func (e *Exporter) collectRegions(ch chan<- prometheus.Metric) error {
+	if !e.shouldReadMetrics() {
+		return nil
+	}
+
+	o := newLatencyObserver("get_regions")
+	regions, err := e.client.Regions().List()
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("could not get regions: %s", err)
+	}
+
+	if e.FederationRegions != "" {
+		known := make(map[string]bool, len(regions))
+		for _, region := range regions {
+			known[region] = true
+		}
+		regions = regions[:0]
+		for _, region := range strings.Split(e.FederationRegions, ",") {
+			region = strings.TrimSpace(region)
+			if !known[region] {
+				LogError(fmt.Errorf("region %s is not federated, skipping it", region))
+				continue
+			}
+			regions = append(regions, region)
+		}
+	}
+
+	var w sync.WaitGroup
+	for _, region := range regions {
+		region := region
+		w.Add(1)
+		go func() {
+			defer w.Done()
+
+			var up float64
+			if err := e.collectRegion(region, ch); err != nil {
+				LogError(fmt.Errorf("could not collect region %s: %s", region, err))
+			} else {
+				up = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				regionUp, prometheus.GaugeValue, up, region,
+			)
+		}()
+	}
+	w.Wait()
+	return nil
+}
+
+// collectRegion collects the nodes and jobs of a region by datacenter, type
+// and status, sending nothing unless both lists succeed
+func (e *Exporter) collectRegion(region string, ch chan<- prometheus.Metric) error {
+	q := e.queryOptions("federation")
+	q.Region = region
+
+	o := newLatencyObserver("get_region_nodes")
+	var nodes []regionNode
+	_, err := e.client.Raw().Query("/v1/nodes", &nodes, q)
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("could not get nodes: %s", err)
+	}
+
+	o = newLatencyObserver("get_region_jobs")
+	var jobs []regionJob
+	err = e.queryPages("/v1/jobs", &jobs, q)
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("could not get jobs: %s", err)
+	}
+
+	nodeCounts := make(map[[2]string]int)
+	for _, n := range nodes {
+		nodeCounts[[2]string{n.Datacenter, n.Status}]++
+	}
+	for key, count := range nodeCounts {
+		ch <- prometheus.MustNewConstMetric(
+			regionNodes, prometheus.GaugeValue, float64(count), region, key[0], key[1],
+		)
+	}
+
+	jobCounts := make(map[[2]string]int)
+	for _, j := range jobs {
+		jobCounts[[2]string{j.Type, j.Status}]++
+	}
+	for key, count := range jobCounts {
+		ch <- prometheus.MustNewConstMetric(
+			regionJobs, prometheus.GaugeValue, float64(count), region, key[0], key[1],
+		)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// flightCall is a collection in progress, the metrics are set once done
+type flightCall struct {
+	ctx     context.Context
+	done    chan struct{}
+	metrics []prometheus.Metric
+}
+
+// flight makes the scrapes that come in while a collection is in progress
+// wait for it and share its metrics, instead of running a collection each,
+// e.g. when two prometheus replicas scrape at the same time. A collection
+// running longer than the budget is aborted: the scrape gets the metrics sent
+// so far, the queries it has in flight are cancelled, and the scrapes that
+// come in until it's done share them rather than piling up collections
+type flight struct {
+	budget time.Duration
+
+	mu   sync.Mutex
+	call *flightCall
+}
+
+// do runs the collection, or waits for the one in progress, and returns its
+// metrics and whether they were shared
+func (f *flight) do(collect func(chan<- prometheus.Metric)) ([]prometheus.Metric, bool) {
+	f.mu.Lock()
+	if c := f.call; c != nil {
+		f.mu.Unlock()
+		<-c.done
+		return c.metrics, true
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &flightCall{ctx: ctx, done: make(chan struct{})}
+	f.call = c
+	f.mu.Unlock()
+
+	collectionsInFlight.Inc()
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collect(ch)
+		close(ch)
+		cancel()
+	}()
+
+	var budget <-chan time.Time
+	if f.budget > 0 {
+		t := time.NewTimer(f.budget)
+		defer t.Stop()
+		budget = t.C
+	}
+
+	var metrics []prometheus.Metric
+	for {
+		select {
+		case m, ok := <-ch:
+			if !ok {
+				c.metrics = metrics
+				f.finish()
+				close(c.done)
+				return metrics, false
+			}
+			metrics = append(metrics, m)
+
+		case <-budget:
+			LogError(fmt.Errorf("collection aborted after %s, serving the %d metrics collected so far", f.budget, len(metrics)))
+			collectionsAborted.Inc()
+			cancel()
+			c.metrics = metrics
+			close(c.done)
+			go func() {
+				for range ch {
+				}
+				f.finish()
+			}()
+			return metrics, false
+		}
+	}
+}
+
+// context returns the context of the collection in progress. Collections
+// don't overlap, an aborted one runs to the end before the next starts, so
+// the requests made meanwhile are the ones of the collection
+func (f *flight) context() context.Context {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.call == nil {
+		return context.Background()
+	}
+	return f.call.ctx
+}
+
+// finish lets the next scrape start a collection
+func (f *flight) finish() {
+	f.mu.Lock()
+	f.call = nil
+	f.mu.Unlock()
+	collectionsInFlight.Dec()
+}
+
+// contextTransport cancels the requests of a collection along with it, the
+// api client doesn't take a context
+type contextTransport struct {
+	flight *flight
+	next   http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(r.WithContext(t.flight.context()))
+}
+
+// collectRuntime collects the goroutines and the heap of the exporter, which
+// leak when collections pile up
+func collectRuntime(ch chan<- prometheus.Metric) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	ch <- prometheus.MustNewConstMetric(
+		exporterGoroutines, prometheus.GaugeValue, float64(runtime.NumGoroutine()),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		exporterHeapBytes, prometheus.GaugeValue, float64(stats.HeapAlloc),
+	)
+}
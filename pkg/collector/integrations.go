@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectIntegrationMetrics collects the state of the Vault and Consul
+// integrations of the agent the exporter talks to, from what the agent
+// noticed talking to them rather than from its config
+func (e *Exporter) collectIntegrationMetrics(ch chan<- prometheus.Metric) error {
+	self, err := e.client.Agent().Self()
+	if err != nil {
+		return fmt.Errorf("could not get agent self: %s", err)
+	}
+
+	node := self.Member.Name
+	if node == "" {
+		node, _ = self.Config["NodeName"].(string)
+	}
+
+	// only the servers keep a vault token, and report its ttl once they
+	// looked it up in vault. It runs out when vault can't renew it
+	if ttl, ok := self.Stats["vault"]["token_ttl"]; ok {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return fmt.Errorf("could not parse vault token ttl %q: %s", ttl, err)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			vaultUp, prometheus.GaugeValue, boolToFloat(d > 0), node,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			vaultTokenTTL, prometheus.GaugeValue, d.Seconds(), node,
+		)
+	}
+
+	var m agentMetrics
+	o := newLatencyObserver("get_agent_metrics")
+	_, err = e.client.Raw().Query("/v1/metrics", &m, nil)
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("could not get agent metrics: %s", err)
+	}
+
+	// the counter is only there for the intervals with failures
+	var failures int
+	for _, c := range m.Counters {
+		if strings.HasSuffix(c.Name, ".client.consul.sync_failure") {
+			failures += c.Count
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		consulSyncFailures, prometheus.GaugeValue, float64(failures), node,
+	)
+	return nil
+}
@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var invalidLabelChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// jobMeta exports the allowed meta keys of the jobs as labels of an info
+// metric. The job list doesn't include the meta, it's read from the job
+// specifications
+type jobMeta struct {
+	keys []string
+	desc *prometheus.Desc
+}
+
+// newJobMeta parses the comma separated allowlist of meta keys, every key is
+// exported as a meta_<key> label
+func newJobMeta(spec string) (*jobMeta, error) {
+	labels := []string{"job", "namespace"}
+	seen := make(map[string]string)
+
+	var keys []string
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("empty meta key in %q", spec)
+		}
+
+		label := "meta_" + invalidLabelChars.ReplaceAllString(key, "_")
+		if other, ok := seen[label]; ok {
+			return nil, fmt.Errorf("meta keys %q and %q would both be exported as label %s", other, key, label)
+		}
+		seen[label] = key
+
+		keys = append(keys, key)
+		labels = append(labels, label)
+	}
+
+	return &jobMeta{
+		keys: keys,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "job_info"),
+			"Job information with the allowed meta keys as labels.",
+			labels, nil,
+		),
+	}, nil
+}
+
+// collectJobMeta exports the info metric of the jobs, children of periodic
+// and parameterized jobs share the meta of their parent and are skipped
+func (e *Exporter) collectJobMeta(stubs []*jobListStub, specs map[string]jobSpecEntry, ch chan<- prometheus.Metric) {
+	for _, stub := range stubs {
+		entry, ok := specs[jobKey(stub.Namespace, stub.ID)]
+		if stub.ParentID != "" || !ok {
+			continue
+		}
+
+		values := make([]string, len(e.jobMeta.keys))
+		for i, key := range e.jobMeta.keys {
+			values[i] = entry.meta[key]
+		}
+		ch <- prometheus.MustNewConstMetric(
+			e.jobMeta.desc, prometheus.GaugeValue, 1,
+			append([]string{stub.ID, stub.Namespace}, values...)...,
+		)
+	}
+}
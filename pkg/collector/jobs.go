@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// jobListStub is a job as listed by the api, with the namespace and node
+// pool newer servers return that the api package doesn't know about
+type jobListStub struct {
+	api.JobListStub
+	Namespace string
+	NodePool  string
+}
+
+// listJobs lists the jobs, along with what the api package drops
+func (e *Exporter) listJobs() ([]*api.JobListStub, []*jobListStub, error) {
+	var mu sync.Mutex
+	var stubs []*jobListStub
+	err := e.listNamespaced("jobs", func(namespace string, q *api.QueryOptions) error {
+		var list []*jobListStub
+		if err := e.queryPages("/v1/jobs", &list, q); err != nil {
+			return err
+		}
+		for _, stub := range list {
+			if stub.Namespace == "" {
+				stub.Namespace = namespace
+			}
+		}
+		mu.Lock()
+		stubs = append(stubs, list...)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jobs := make([]*api.JobListStub, len(stubs))
+	for i, stub := range stubs {
+		if stub.Namespace == "" {
+			stub.Namespace = api.DefaultNamespace
+		}
+		jobs[i] = &stub.JobListStub
+	}
+	return jobs, stubs, nil
+}
+
+// jobKey identifies a job across namespaces, whose names can't have a slash
+func jobKey(namespace, id string) string {
+	return namespace + "/" + id
+}
+
+type jobsKey struct {
+	jobType, status, namespace, nodePool string
+}
+
+// collectJobBreakdown exports how many jobs there are by type, status,
+// namespace and node pool, and the priority of every job
+func collectJobBreakdown(stubs []*jobListStub, ch chan<- prometheus.Metric) {
+	counts := make(map[jobsKey]int)
+	for _, stub := range stubs {
+		counts[jobsKey{stub.Type, stub.Status, stub.Namespace, stub.NodePool}]++
+
+		// children run with the priority of their parent
+		if stub.ParentID != "" {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			jobPriority, prometheus.GaugeValue, float64(stub.Priority),
+			stub.ID, stub.Type, stub.Namespace,
+		)
+	}
+
+	for k, count := range counts {
+		ch <- prometheus.MustNewConstMetric(
+			jobsCount, prometheus.GaugeValue, float64(count),
+			k.jobType, k.status, k.namespace, k.nodePool,
+		)
+	}
+}
@@ -0,0 +1,265 @@
+package collector
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// jobSpec is the part of a job specification the exporter reads, including
+// the identity blocks newer servers return that the api package doesn't know
+// about
+type jobSpec struct {
+	Meta       map[string]string
+	Periodic   *api.PeriodicConfig
+	TaskGroups []struct {
+		Name          string
+		Count         *int
+		Services      []struct{}
+		EphemeralDisk *struct {
+			SizeMB *int
+		}
+		Tasks []struct {
+			Identity   *struct{}
+			Identities []struct{}
+			Vault      *struct{}
+			Services   []struct{}
+			Resources  *struct {
+				CPU         *int
+				MemoryMB    *int
+				MemoryMaxMB *int
+			}
+		}
+	}
+}
+
+// jobSpecs keeps what's only in the job specifications: how many allocations
+// the task groups of the service jobs should run, what every allocation of
+// the task groups requests, which integrations the tasks use, the meta of the
+// jobs and when the periodic ones launch. The job list doesn't include them, so the jobs are fetched once
+// for all the collectors reading them and kept until their modify index
+// changes
+type jobSpecs struct {
+	mu      sync.Mutex
+	cache   map[string]jobSpecEntry
+	changed bool
+}
+
+type jobSpecEntry struct {
+	modifyIndex  uint64
+	counts       map[string]int
+	requests     map[string]groupRequest
+	tasks        int
+	integrations map[string]int
+	meta         map[string]string
+	periodic     *api.PeriodicConfig
+}
+
+// groupRequest is what an allocation of a task group requests, the sum of
+// its tasks. The memory max is the memory when the tasks don't oversubscribe
+type groupRequest struct {
+	CPU         int `json:"cpu"`
+	MemoryMB    int `json:"memory_mb"`
+	MemoryMaxMB int `json:"memory_max_mb"`
+	DiskMB      int `json:"disk_mb"`
+}
+
+// taskIntegrations are the integrations the tasks are counted by
+var taskIntegrations = []string{"identity", "vault", "consul"}
+
+func newJobSpecs() *jobSpecs {
+	return &jobSpecs{
+		cache: make(map[string]jobSpecEntry),
+	}
+}
+
+// refreshJobSpecs fetches the specifications of the jobs that changed since
+// they were fetched, through the job pool and without holding the cache, and
+// returns the specifications by job key. Children of periodic and
+// parameterized jobs share the specification of their parent and are skipped
+func (e *Exporter) refreshJobSpecs(stubs []*jobListStub) map[string]jobSpecEntry {
+	s := e.jobSpecs
+	s.mu.Lock()
+	cache := make(map[string]jobSpecEntry, len(s.cache))
+	var stale []*jobListStub
+	for _, stub := range stubs {
+		if stub.ParentID != "" {
+			continue
+		}
+		key := jobKey(stub.Namespace, stub.ID)
+		if entry, ok := s.cache[key]; ok && entry.modifyIndex == stub.JobModifyIndex {
+			cache[key] = entry
+			continue
+		}
+		stale = append(stale, stub)
+	}
+	s.mu.Unlock()
+
+	var mu sync.Mutex
+	var w sync.WaitGroup
+	for _, stub := range stale {
+		stub := stub
+		e.jobPool.Go(&w, func() {
+			entry, err := e.fetchJobSpec(stub)
+			if err != nil {
+				LogError(err)
+				return
+			}
+			mu.Lock()
+			cache[jobKey(stub.Namespace, stub.ID)] = entry
+			mu.Unlock()
+		})
+	}
+	w.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(stale) > 0 || len(cache) != len(s.cache) {
+		s.changed = true
+	}
+	s.cache = cache
+	return cache
+}
+
+// collectJobSpecs exports the metrics of the job specifications
+func collectJobSpecs(stubs []*jobListStub, specs map[string]jobSpecEntry, ch chan<- prometheus.Metric) {
+	for _, stub := range stubs {
+		entry, ok := specs[jobKey(stub.Namespace, stub.ID)]
+		if stub.ParentID != "" || !ok {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			jobTasks, prometheus.GaugeValue, float64(entry.tasks),
+			stub.ID, stub.Namespace,
+		)
+		for _, integration := range taskIntegrations {
+			ch <- prometheus.MustNewConstMetric(
+				jobTaskIntegrations, prometheus.GaugeValue, float64(entry.integrations[integration]),
+				stub.ID, stub.Namespace, integration,
+			)
+		}
+
+		collectJobGroupRequests(stub, entry, ch)
+		if stub.Type == "service" && stub.JobSummary != nil {
+			collectJobGroupCounts(stub, entry.counts, ch)
+		}
+	}
+}
+
+// collectJobGroupCounts exports the desired and running allocations of the
+// service job, stopped jobs are desired to run none
+func collectJobGroupCounts(stub *jobListStub, counts map[string]int, ch chan<- prometheus.Metric) {
+	desired := counts
+	if stub.Stop {
+		desired = make(map[string]int, len(stub.JobSummary.Summary))
+		for group := range stub.JobSummary.Summary {
+			desired[group] = 0
+		}
+	}
+
+	for group, count := range desired {
+		ch <- prometheus.MustNewConstMetric(
+			jobAllocationsDesired, prometheus.GaugeValue, float64(count),
+			stub.ID, stub.Namespace, group,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			jobAllocationsRunning, prometheus.GaugeValue,
+			float64(stub.JobSummary.Summary[group].Running),
+			stub.ID, stub.Namespace, group,
+		)
+	}
+}
+
+// collectJobGroupRequests exports the count of the task groups of the job and
+// what every allocation of them requests, whether they run or not
+func collectJobGroupRequests(stub *jobListStub, entry jobSpecEntry, ch chan<- prometheus.Metric) {
+	for group, count := range entry.counts {
+		labels := []string{stub.ID, stub.Namespace, group}
+		r := entry.requests[group]
+		ch <- prometheus.MustNewConstMetric(
+			jobGroupCount, prometheus.GaugeValue, float64(count), labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			jobGroupRequestedCPU, prometheus.GaugeValue, float64(r.CPU), labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			jobGroupRequestedMemory, prometheus.GaugeValue, float64(r.MemoryMB)*1024*1024, labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			jobGroupRequestedMemoryMax, prometheus.GaugeValue, float64(r.MemoryMaxMB)*1024*1024, labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			jobGroupRequestedDisk, prometheus.GaugeValue, float64(r.DiskMB)*1024*1024, labels...,
+		)
+	}
+}
+
+func (e *Exporter) fetchJobSpec(stub *jobListStub) (jobSpecEntry, error) {
+	var job jobSpec
+	q := e.queryOptions("jobs")
+	q.Namespace = stub.Namespace
+	o := newLatencyObserver("get_job_spec")
+	_, err := e.client.Raw().Query("/v1/job/"+url.PathEscape(stub.ID), &job, q)
+	o.observe()
+	if err != nil {
+		return jobSpecEntry{}, fmt.Errorf("could not get specification of job %s of namespace %s: %s", stub.ID, stub.Namespace, err)
+	}
+
+	entry := jobSpecEntry{
+		modifyIndex:  stub.JobModifyIndex,
+		counts:       make(map[string]int, len(job.TaskGroups)),
+		requests:     make(map[string]groupRequest, len(job.TaskGroups)),
+		integrations: make(map[string]int),
+		meta:         job.Meta,
+		periodic:     job.Periodic,
+	}
+	for _, group := range job.TaskGroups {
+		count := 1
+		if group.Count != nil {
+			count = *group.Count
+		}
+		entry.counts[group.Name] = count
+
+		var request groupRequest
+		if group.EphemeralDisk != nil && group.EphemeralDisk.SizeMB != nil {
+			request.DiskMB = *group.EphemeralDisk.SizeMB
+		}
+		for _, task := range group.Tasks {
+			if r := task.Resources; r != nil {
+				var memory, memoryMax int
+				if r.CPU != nil {
+					request.CPU += *r.CPU
+				}
+				if r.MemoryMB != nil {
+					memory = *r.MemoryMB
+				}
+				memoryMax = memory
+				if r.MemoryMaxMB != nil && *r.MemoryMaxMB > memory {
+					memoryMax = *r.MemoryMaxMB
+				}
+				request.MemoryMB += memory
+				request.MemoryMaxMB += memoryMax
+			}
+		}
+		entry.requests[group.Name] = request
+
+		for _, task := range group.Tasks {
+			entry.tasks++
+			if task.Identity != nil || len(task.Identities) > 0 {
+				entry.integrations["identity"]++
+			}
+			if task.Vault != nil {
+				entry.integrations["vault"]++
+			}
+			// the services of the group are registered for all of its tasks
+			if len(task.Services) > 0 || len(group.Services) > 0 {
+				entry.integrations["consul"]++
+			}
+		}
+	}
+	return entry, nil
+}
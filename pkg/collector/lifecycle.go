@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// lifecycleAllocation is the part of an allocation the lifecycle of its tasks
+// is read from, the api package doesn't know about the lifecycle block
+type lifecycleAllocation struct {
+	Namespace string
+	JobID     string
+	Job       *struct {
+		Version    *uint64
+		TaskGroups []struct {
+			Name  string
+			Tasks []struct {
+				Name      string
+				Lifecycle *struct {
+					Hook    string
+					Sidecar bool
+				}
+			}
+		}
+	}
+}
+
+// taskLifecycles is the lifecycle of every task of a job version, by task
+// group and task
+type taskLifecycles map[string]map[string]string
+
+// lifecycles returns the lifecycle of the tasks of the job: main without a
+// lifecycle block, sidecar when the task runs along the main ones, the hook
+// otherwise
+func (a *lifecycleAllocation) lifecycles() taskLifecycles {
+	lifecycles := make(taskLifecycles)
+	for _, tg := range a.Job.TaskGroups {
+		tasks := make(map[string]string)
+		for _, task := range tg.Tasks {
+			switch {
+			case task.Lifecycle == nil || task.Lifecycle.Hook == "":
+				tasks[task.Name] = "main"
+			case task.Lifecycle.Sidecar:
+				tasks[task.Name] = "sidecar"
+			default:
+				tasks[task.Name] = task.Lifecycle.Hook
+			}
+		}
+		lifecycles[tg.Name] = tasks
+	}
+	return lifecycles
+}
+
+// queryAllocations queries an endpoint returning an allocation, or a list of
+// them, into out and keeps the lifecycle of the tasks of their job versions
+func (e *Exporter) queryAllocations(endpoint string, out interface{}, q *api.QueryOptions) error {
+	body, err := e.client.Raw().Response(endpoint, q)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %s", endpoint, err)
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("could not decode %s: %s", endpoint, err)
+	}
+
+	var allocs []*lifecycleAllocation
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		err = json.Unmarshal(b, &allocs)
+	} else {
+		var alloc lifecycleAllocation
+		err = json.Unmarshal(b, &alloc)
+		allocs = append(allocs, &alloc)
+	}
+	if err != nil {
+		return fmt.Errorf("could not decode the task lifecycles of %s: %s", endpoint, err)
+	}
+	for _, alloc := range allocs {
+		if alloc.Job == nil || alloc.Job.Version == nil {
+			continue
+		}
+		key := jobVersionKey{alloc.Namespace, alloc.JobID, *alloc.Job.Version}
+		e.allocationJobs.putLifecycles(key, alloc.lifecycles())
+	}
+	return nil
+}
+
+// taskKind is what the task metrics are labeled with besides the task
+type taskKind struct {
+	driver, lifecycle string
+}
+
+// taskKinds returns the driver and the lifecycle of every task of the
+// allocation, from the job the allocation runs
+func (e *Exporter) taskKinds(alloc *api.Allocation) map[string]taskKind {
+	kinds := make(map[string]taskKind)
+	if alloc.Job == nil {
+		return kinds
+	}
+
+	var lifecycles map[string]string
+	if alloc.Job.Version != nil {
+		key := jobVersionKey{alloc.Namespace, alloc.JobID, *alloc.Job.Version}
+		lifecycles = e.allocationJobs.getLifecycles(key)[alloc.TaskGroup]
+	}
+	for _, tg := range alloc.Job.TaskGroups {
+		if tg.Name == nil || *tg.Name != alloc.TaskGroup {
+			continue
+		}
+		for _, task := range tg.Tasks {
+			kinds[task.Name] = taskKind{driver: task.Driver, lifecycle: lifecycles[task.Name]}
+		}
+	}
+	return kinds
+}
@@ -0,0 +1,990 @@
+package collector
+
+import (
+	"time"
+
+	go_ver "github.com/hashicorp/go-version"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	namespace = "nomad"
+)
+
+var (
+	up = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "up"),
+		"Wether the exporter is able to talk to the nomad server.",
+		nil, nil,
+	)
+	poolWorkers = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "pool_workers"),
+		"How many api calls the collector pool makes at once.",
+		[]string{"pool"}, nil,
+	)
+	poolQueueDepth = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "pool_queue_depth"),
+		"The most callers waiting for a free worker of the collector pool since the last collection.",
+		[]string{"pool"}, nil,
+	)
+	nodeCircuitOpen = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "node_circuit_open"),
+		"Wether the node is not queried for failing too many times in a row.",
+		[]string{"node", "node_id"}, nil,
+	)
+	metricsSuppressed = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "metrics_suppressed"),
+		"Wether cluster metrics are suppressed because this exporter is not talking to the leader.",
+		nil, nil,
+	)
+	lastCollectSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "last_collect_success_timestamp"),
+		"When a collection last succeeded without errors, in seconds since the epoch.",
+		nil, nil,
+	)
+	collectorCached = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "collector_cached"),
+		"Wether the metrics of the collector were served from an earlier collection.",
+		[]string{"collector"}, nil,
+	)
+	collectFailures = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "collect_failures_total"),
+		"Number of collections in which a collector failed.",
+		nil, nil,
+	)
+	clientErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "client_errors_total",
+			Help:      "Number of errors that were accounted for.",
+		})
+	coalescedScrapes = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "coalesced_scrapes_total",
+			Help:      "Number of scrapes that shared the collection of a concurrent scrape.",
+		})
+	collectionsInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "collections_in_flight",
+			Help:      "Number of collections running, aborted ones included until they're done.",
+		})
+	collectionsAborted = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "collections_aborted_total",
+			Help:      "Number of collections aborted for running longer than the collection budget.",
+		})
+	exporterGoroutines = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "goroutines"),
+		"Number of goroutines of the exporter.",
+		nil, nil,
+	)
+	exporterHeapBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "heap_bytes"),
+		"Bytes of heap objects the exporter allocated and didn't free yet.",
+		nil, nil,
+	)
+	namespaceErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "namespace_errors_total",
+			Help:      "Number of times listing the objects of a namespace failed, by collector.",
+		},
+		[]string{"collector", "namespace"},
+	)
+	clusterLeader = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "leader"),
+		"Wether the current host is the cluster leader.",
+		nil, nil)
+	raftLeaderChanges = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "raft_leader_changes_total",
+			Help:      "Number of leadership changes observed between collections.",
+		})
+	raftLastContact = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "raft_last_contact_seconds"),
+		"How long ago the server last heard from the leader, as reported by autopilot.",
+		[]string{"server", "leader"}, nil,
+	)
+	raftServerProtocol = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "raft_server_protocol_version"),
+		"Raft protocol version the server speaks.",
+		[]string{"server", "address", "voter"}, nil,
+	)
+	autopilotHealthy = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "autopilot", "healthy"),
+		"Wether autopilot considers every server healthy.",
+		nil, nil,
+	)
+	autopilotFailureTolerance = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "autopilot", "failure_tolerance"),
+		"How many voting servers can fail without losing the quorum.",
+		nil, nil,
+	)
+	autopilotServerHealthy = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "autopilot", "server_healthy"),
+		"Wether autopilot considers the server healthy, with the version it runs.",
+		[]string{"server", "version", "voter"}, nil,
+	)
+	autopilotUpgradeMigration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "autopilot", "upgrade_migration_enabled"),
+		"Wether autopilot migrates to servers of a newer version once there are enough of them.",
+		nil, nil,
+	)
+	serverVersion = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "server", "version_info"),
+		"Version of every server in the gossip pool, always 1.",
+		[]string{"server", "region", "datacenter", "version"}, nil,
+	)
+	serverMemberStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "server", "member_status"),
+		"Wether the server in the gossip pool is alive, leaving, left or failed.",
+		[]string{"server", "region", "datacenter", "status"}, nil,
+	)
+	serverMemberProtocol = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "server", "member_protocol_version"),
+		"Serf and delegate protocol versions the server in the gossip pool speaks.",
+		[]string{"server", "region", "datacenter", "protocol"}, nil,
+	)
+	clusterServers = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "raft_peers"),
+		"How many peers (servers) are in the Raft cluster.",
+		nil, nil,
+	)
+	nodeInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_info"),
+		"Node information",
+		[]string{"class", "datacenter", "drain", "name", "node_id", "scheduling_eligibility", "status", "version"},
+		nil,
+	)
+	nodeCost = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "cost_per_hour"),
+		"Hourly cost of the node, per the cost config.",
+		[]string{"node", "datacenter", "node_class"}, nil,
+	)
+	jobCost = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "job", "allocated_cost_per_hour"),
+		"Hourly cost of the running allocations of the job, their dominant share of the resources of their nodes priced per the cost config.",
+		[]string{"job_id", "namespace"}, nil,
+	)
+	nodeEligible = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "eligible"),
+		"Wether the node is eligible for scheduling.",
+		[]string{"node", "datacenter", "node_class"}, nil,
+	)
+	serfLanMembers = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "serf_lan_members"),
+		"How many members are in the cluster.",
+		nil, nil,
+	)
+	serfLanMembersStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "serf_lan_member_status"),
+		"Describe member state.",
+		[]string{"class", "datacenter", "node", "node_id", "drain"}, nil,
+	)
+	nodeStatusInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "status_info"),
+		"Status of the node and why the servers set it, always 1.",
+		[]string{"node", "node_id", "status", "description"}, nil,
+	)
+	nodeStatusChanged = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "status_changed_timestamp"),
+		"When the status of the node last changed, in seconds since the epoch.",
+		[]string{"node", "node_id", "status"}, nil,
+	)
+	nodeMissedHeartbeats = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "missed_heartbeats"),
+		"How many of the latest events of the node are missed heartbeats.",
+		[]string{"node", "node_id"}, nil,
+	)
+	raftAppliedIndex = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "raft_applied_index"),
+		"Index being applied.",
+		[]string{"datacenter", "node"}, nil,
+	)
+	raftCommitIndex = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "raft_commit_index"),
+		"Index being committed.",
+		[]string{"datacenter", "node"}, nil,
+	)
+	raftFsmPending = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "raft_fsm_pending"),
+		"Pending FSM.",
+		[]string{"datacenter", "node"}, nil,
+	)
+	raftLastLogIndex = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "raft_last_log_index"),
+		"Last log index.",
+		[]string{"datacenter", "node"}, nil,
+	)
+	raftLastSnapshotIndex = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "raft_last_snapshot_index"),
+		"Last snapshot index.",
+		[]string{"datacenter", "node"}, nil,
+	)
+	raftNumPeers = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "raft_num_peers"),
+		"Number of Raft peers.",
+		[]string{"datacenter", "node"}, nil,
+	)
+	brokerEvals = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "broker", "evals"),
+		"How many evaluations are in the eval broker, by state.",
+		[]string{"state"}, nil,
+	)
+	brokerSchedulerEvals = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "broker", "scheduler_evals"),
+		"How many evaluations are in the eval broker for each scheduler, by state.",
+		[]string{"scheduler", "state"}, nil,
+	)
+	planQueueDepth = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "plan", "queue_depth"),
+		"How many plans are waiting to be applied.",
+		nil, nil,
+	)
+	planOperationCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "plan", "operations"),
+		"How many plans the leader submitted, evaluated, applied or waited for over the last telemetry interval.",
+		[]string{"server", "operation"}, nil,
+	)
+	planOperationMean = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "plan", "operation_mean_seconds"),
+		"How long plan operations took on average over the last telemetry interval.",
+		[]string{"server", "operation"}, nil,
+	)
+	planOperationMax = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "plan", "operation_max_seconds"),
+		"How long the slowest plan operation took over the last telemetry interval.",
+		[]string{"server", "operation"}, nil,
+	)
+	planRejections = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "plan", "node_rejections"),
+		"How many times the leader rejected a plan for a node over the last telemetry interval.",
+		[]string{"server"}, nil,
+	)
+	planNodeRejections = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "plan", "node_rejections_by_node"),
+		"How many times the leader rejected a plan for the node over the last telemetry interval.",
+		[]string{"server", "node"}, nil,
+	)
+	schedulerConfigInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scheduler", "config_info"),
+		"Scheduler configuration of the cluster, always 1.",
+		[]string{"algorithm"}, nil,
+	)
+	schedulerMemoryOversubscription = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scheduler", "memory_oversubscription_enabled"),
+		"Wether jobs can use more memory than they reserve.",
+		nil, nil,
+	)
+	schedulerPreemption = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scheduler", "preemption_enabled"),
+		"Wether the scheduler evicts lower priority allocations to place higher priority ones.",
+		[]string{"scheduler"}, nil,
+	)
+	keyringKeys = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "keyring", "keys"),
+		"How many root encryption keys there are, by state.",
+		[]string{"state"}, nil,
+	)
+	keyringActiveKeyCreateTime = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "keyring", "active_key_create_timestamp"),
+		"When the active root encryption key was created, in seconds since the epoch.",
+		[]string{"key_id"}, nil,
+	)
+	vaultUp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "vault_up"),
+		"Wether the Vault token of the agent is alive, it runs out when the agent can't renew it with Vault.",
+		[]string{"node"}, nil,
+	)
+	vaultTokenTTL = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "client", "vault_token_ttl_seconds"),
+		"Remaining time to live of the Vault token of the agent.",
+		[]string{"node"}, nil,
+	)
+	consulSyncFailures = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "consul_sync_failures"),
+		"How many times the agent failed to sync its services and checks with Consul over the last telemetry interval.",
+		[]string{"node"}, nil,
+	)
+	jobsTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "jobs_total"),
+		"How many jobs are there in the cluster.",
+		nil, nil,
+	)
+	jobsCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "jobs"),
+		"How many jobs there are by type, status, namespace and node pool.",
+		[]string{"type", "status", "namespace", "node_pool"}, nil,
+	)
+	jobPriority = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_priority"),
+		"Priority of the job.",
+		[]string{"job_id", "type", "namespace"}, nil,
+	)
+	jobAllocationsDesired = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_allocations_desired"),
+		"How many allocations the task group of the service job should run.",
+		[]string{"job_id", "namespace", "group"}, nil,
+	)
+	jobAllocationsRunning = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_allocations_running"),
+		"How many allocations of the task group of the service job are running.",
+		[]string{"job_id", "namespace", "group"}, nil,
+	)
+	jobGroupCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "job", "task_group_count"),
+		"How many allocations the job specification asks of the task group.",
+		[]string{"job_id", "namespace", "group"}, nil,
+	)
+	jobGroupRequestedCPU = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "job", "task_group_requested_cpu_megahertz"),
+		"CPU every allocation of the task group requests in MHz, per the job specification.",
+		[]string{"job_id", "namespace", "group"}, nil,
+	)
+	jobGroupRequestedMemory = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "job", "task_group_requested_memory_bytes"),
+		"Memory every allocation of the task group requests, per the job specification.",
+		[]string{"job_id", "namespace", "group"}, nil,
+	)
+	jobGroupRequestedMemoryMax = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "job", "task_group_requested_memory_max_bytes"),
+		"Memory every allocation of the task group may use with memory oversubscription, per the job specification.",
+		[]string{"job_id", "namespace", "group"}, nil,
+	)
+	jobGroupRequestedDisk = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "job", "task_group_requested_disk_bytes"),
+		"Ephemeral disk every allocation of the task group requests, per the job specification.",
+		[]string{"job_id", "namespace", "group"}, nil,
+	)
+	jobTasks = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_tasks"),
+		"How many tasks the job specifies.",
+		[]string{"job_id", "namespace"}, nil,
+	)
+	jobTaskIntegrations = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_task_integrations"),
+		"How many tasks of the job use a workload identity, vault or consul services.",
+		[]string{"job_id", "namespace", "integration"}, nil,
+	)
+	jobStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_status"),
+		"Wether the job is pending, running or dead.",
+		[]string{"job_id", "type", "namespace", "status"}, nil,
+	)
+	jobSubmitTime = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_submit_timestamp"),
+		"When the current version of the job was submitted, in seconds since the epoch.",
+		[]string{"job_id", "type", "namespace"}, nil,
+	)
+	jobChildren = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_children"),
+		"How many child jobs a periodic or parameterized job has launched, by status.",
+		[]string{"job_id", "namespace", "status"}, nil,
+	)
+	jobBatchAllocations = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_batch_allocations"),
+		"How many allocations of the batch job and its children are complete, failed or running.",
+		[]string{"job_id", "namespace", "status"}, nil,
+	)
+	jobBatchLastComplete = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_batch_last_complete_timestamp"),
+		"When an allocation of the batch job or its children last completed, in seconds since the epoch.",
+		[]string{"job_id", "namespace"}, nil,
+	)
+	jobPeriodicNextLaunch = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_periodic_next_launch_timestamp"),
+		"When the periodic job launches next, in seconds since the epoch.",
+		[]string{"job_id", "namespace"}, nil,
+	)
+	allocationMemoryBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_memory_rss_bytes"),
+		"Allocation memory usage",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	allocationMemoryBytesRequired = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_memory_rss_required_bytes"),
+		"Allocation memory required.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	allocationCPURequired = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_cpu_required"),
+		"Allocation CPU Required.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	allocationCPUPercent = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_cpu_percent"),
+		"Allocation CPU usage.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	allocationCPUTicks = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_cpu_ticks"),
+		"Allocation CPU Ticks usage.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	allocationCPUUserMode = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_cpu_user_mode"),
+		"Allocation CPU User Mode Usage.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	allocationCPUSystemMode = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_cpu_system_mode"),
+		"Allocation CPU System Mode Usage.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	allocationCPUThrottled = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_cpu_throttle_time"),
+		"Allocation throttled CPU.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	allocationCPUTicksTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_cpu_ticks_total"),
+		"Allocation CPU Ticks usage.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	allocationCPUUserModeTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_cpu_user_mode_total"),
+		"Allocation CPU User Mode Usage.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	allocationCPUSystemModeTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_cpu_system_mode_total"),
+		"Allocation CPU System Mode Usage.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	allocationCPUThrottledTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_cpu_throttle_time_total"),
+		"Allocation throttled CPU.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	allocationMemoryStatBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_memory_stat_bytes"),
+		"Allocation memory stats beyond RSS in bytes, as measured by the drivers.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "stat"}, nil,
+	)
+	taskMemoryStatBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "task_memory_stat_bytes"),
+		"Task memory stats beyond RSS in bytes, as measured by the driver.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task", "driver", "lifecycle", "stat"}, nil,
+	)
+	nodeOtherAllocations = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "other_allocations"),
+		"How many running allocations of the node are not among the top ones.",
+		[]string{"node", "datacenter"}, nil,
+	)
+	nodeOtherAllocationsCPUPercent = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "other_allocations_cpu_percent"),
+		"CPU usage of the running allocations of the node that are not among the top ones.",
+		[]string{"node", "datacenter"}, nil,
+	)
+	nodeOtherAllocationsMemoryBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "other_allocations_memory_rss_bytes"),
+		"Memory usage of the running allocations of the node that are not among the top ones.",
+		[]string{"node", "datacenter"}, nil,
+	)
+	groupAllocations = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_group_allocations"),
+		"How many allocations of the task group are running and reporting stats.",
+		[]string{"job", "group", "region", "datacenter"}, nil,
+	)
+	groupCPUPercent = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_group_cpu_percent"),
+		"CPU usage of the running allocations of the task group.",
+		[]string{"job", "group", "region", "datacenter"}, nil,
+	)
+	groupMemoryBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_group_memory_rss_bytes"),
+		"Memory usage of the running allocations of the task group.",
+		[]string{"job", "group", "region", "datacenter"}, nil,
+	)
+	groupMemoryStatBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_group_memory_stat_bytes"),
+		"Memory stats beyond RSS of the running allocations of the task group in bytes, as measured by the drivers.",
+		[]string{"job", "group", "region", "datacenter", "stat"}, nil,
+	)
+	groupMemoryBytesRequired = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_group_memory_rss_required_bytes"),
+		"Memory required by the running allocations of the task group.",
+		[]string{"job", "group", "region", "datacenter"}, nil,
+	)
+	groupCPURequired = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_group_cpu_required"),
+		"CPU required by the running allocations of the task group.",
+		[]string{"job", "group", "region", "datacenter"}, nil,
+	)
+	allocationPortInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_port_info"),
+		"Port allocated to a task of the allocation, with the host ip it's reachable at.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task", "port_label", "ip", "port"}, nil,
+	)
+	allocationCreateTimestamp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_create_timestamp"),
+		"When the allocation was created, in seconds since the epoch.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	allocationModifyTimestamp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_modify_timestamp"),
+		"When the allocation was last modified, in seconds since the epoch.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node"}, nil,
+	)
+	taskStartedTimestamp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "task_started_timestamp"),
+		"When the task last started, in seconds since the epoch.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task", "driver", "lifecycle"}, nil,
+	)
+	taskFinishedTimestamp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "task_finished_timestamp"),
+		"When the task finished, in seconds since the epoch.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task", "driver", "lifecycle"}, nil,
+	)
+	taskLastExitCode = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "task_last_exit_code"),
+		"The exit code of the task the last time it terminated.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task", "driver", "lifecycle"}, nil,
+	)
+	taskLastExitSignal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "task_last_exit_signal"),
+		"The signal that terminated the task the last time it terminated, 0 when it exited by itself.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task", "driver", "lifecycle"}, nil,
+	)
+	taskLastExitOOMKilled = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "task_last_exit_oom_killed"),
+		"Wether the task was killed for running out of memory the last time it terminated.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task", "driver", "lifecycle"}, nil,
+	)
+	allocationDeploymentHealthy = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "allocation", "deployment_healthy"),
+		"Wether the allocation is healthy as part of its deployment, exported once its health is known.",
+		[]string{"job", "task_group", "alloc_id", "canary"}, nil,
+	)
+	regionUp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "region", "up"),
+		"Wether the servers of the federated region answered the last collection.",
+		[]string{"region"}, nil,
+	)
+	regionNodes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "region", "nodes"),
+		"How many nodes the federated region has, by datacenter and status.",
+		[]string{"region", "datacenter", "status"}, nil,
+	)
+	regionJobs = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "region", "jobs"),
+		"How many jobs the federated region has, by type and status.",
+		[]string{"region", "type", "status"}, nil,
+	)
+	allocationPlacementScore = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "allocation", "placement_score"),
+		"The score the scheduler gave the node when placing the allocation, by scorer.",
+		[]string{"job", "task_group", "alloc_id", "node", "placed", "scorer"}, nil,
+	)
+	allocationZombies = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_zombies"),
+		"Allocation zombies.",
+		nil, nil,
+	)
+	taskCPUTotalTicks = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "task_cpu_total_ticks"),
+		"Task CPU total ticks.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task", "driver", "lifecycle"}, nil,
+	)
+	taskCPUTicksTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "task_cpu_ticks_total"),
+		"Task CPU total ticks.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task", "driver", "lifecycle"}, nil,
+	)
+	taskCPUPercent = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "task_cpu_percent"),
+		"Task CPU usage percent.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task", "driver", "lifecycle"}, nil,
+	)
+	taskMemoryRssBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "task_memory_rss_bytes"),
+		"Task memory RSS usage in bytes.",
+		[]string{"job", "job_version", "group", "alloc", "region", "datacenter", "node", "task", "driver", "lifecycle"}, nil,
+	)
+
+	nodeResourceMemory = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_resource_memory_bytes"),
+		"Amount of allocatable memory the node has in bytes",
+		[]string{"node", "datacenter"}, nil,
+	)
+	nodeAllocatedMemory = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_allocated_memory_bytes"),
+		"Amount of memory allocated to tasks on the node in bytes.",
+		[]string{"node", "datacenter"}, nil,
+	)
+	nodeUsedMemory = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_used_memory_bytes"),
+		"Amount of memory used on the node in bytes.",
+		[]string{"node", "datacenter"}, nil,
+	)
+	nodeResourceCPU = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_resource_cpu_megahertz"),
+		"Amount of allocatable CPU the node has in MHz",
+		[]string{"node", "datacenter"}, nil,
+	)
+	nodeResourceIOPS = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_resource_iops"),
+		"Amount of allocatable IOPS the node has.",
+		[]string{"node", "datacenter"}, nil,
+	)
+	nodeResourceDiskBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_resource_disk_bytes"),
+		"Amount of allocatable disk bytes the node has.",
+		[]string{"node", "datacenter"}, nil,
+	)
+	nodeAllocatedCPU = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_allocated_cpu_megahertz"),
+		"Amount of allocated CPU on the node in MHz.",
+		[]string{"node", "datacenter"}, nil,
+	)
+	datacenterNodes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "datacenter", "nodes"),
+		"How many nodes the datacenter has, by status.",
+		[]string{"datacenter", "status"}, nil,
+	)
+	datacenterAllocatableCPU = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "datacenter", "allocatable_cpu_megahertz"),
+		"CPU the ready nodes of the datacenter can allocate, less the reserved one, in MHz.",
+		[]string{"datacenter"}, nil,
+	)
+	datacenterAllocatableMemory = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "datacenter", "allocatable_memory_bytes"),
+		"Memory the ready nodes of the datacenter can allocate, less the reserved one.",
+		[]string{"datacenter"}, nil,
+	)
+	datacenterAllocatedCPU = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "datacenter", "allocated_cpu_megahertz"),
+		"CPU allocated on the ready nodes of the datacenter in MHz.",
+		[]string{"datacenter"}, nil,
+	)
+	datacenterAllocatedMemory = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "datacenter", "allocated_memory_bytes"),
+		"Memory allocated on the ready nodes of the datacenter.",
+		[]string{"datacenter"}, nil,
+	)
+	regionNodeCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "region", "node_count"),
+		"How many nodes the region of the servers has, by status.",
+		[]string{"region", "status"}, nil,
+	)
+	regionAllocatableCPU = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "region", "allocatable_cpu_megahertz"),
+		"CPU the ready nodes of the region of the servers can allocate, less the reserved one, in MHz.",
+		[]string{"region"}, nil,
+	)
+	regionAllocatableMemory = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "region", "allocatable_memory_bytes"),
+		"Memory the ready nodes of the region of the servers can allocate, less the reserved one.",
+		[]string{"region"}, nil,
+	)
+	regionAllocatedCPU = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "region", "allocated_cpu_megahertz"),
+		"CPU allocated on the ready nodes of the region of the servers in MHz.",
+		[]string{"region"}, nil,
+	)
+	regionAllocatedMemory = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "region", "allocated_memory_bytes"),
+		"Memory allocated on the ready nodes of the region of the servers.",
+		[]string{"region"}, nil,
+	)
+	nodeMemoryBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_memory_bytes"),
+		"Host memory of the node in bytes, by state.",
+		[]string{"node", "datacenter", "state"}, nil,
+	)
+	nodeCPUPercent = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_cpu_percent"),
+		"Usage of each CPU core of the node in percent, by mode.",
+		[]string{"node", "datacenter", "cpu", "mode"}, nil,
+	)
+	nodeDiskSizeBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_disk_size_bytes"),
+		"Size of the disk of the node in bytes.",
+		[]string{"node", "datacenter", "device", "mount"}, nil,
+	)
+	nodeDiskUsedBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_disk_used_bytes"),
+		"Used space of the disk of the node in bytes.",
+		[]string{"node", "datacenter", "device", "mount"}, nil,
+	)
+	nodeDiskAvailableBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_disk_available_bytes"),
+		"Available space of the disk of the node in bytes.",
+		[]string{"node", "datacenter", "device", "mount"}, nil,
+	)
+	nodeDiskInodesUsedPercent = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_disk_inodes_used_percent"),
+		"Used inodes of the disk of the node in percent.",
+		[]string{"node", "datacenter", "device", "mount"}, nil,
+	)
+	nodeReservedCPU = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_reserved_cpu_megahertz"),
+		"Amount of CPU reserved on the node for processes outside of nomad in MHz.",
+		[]string{"node", "datacenter"}, nil,
+	)
+	nodeReservedMemory = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_reserved_memory_bytes"),
+		"Amount of memory reserved on the node for processes outside of nomad in bytes.",
+		[]string{"node", "datacenter"}, nil,
+	)
+	nodeReservedDiskBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_reserved_disk_bytes"),
+		"Amount of disk reserved on the node for processes outside of nomad in bytes.",
+		[]string{"node", "datacenter"}, nil,
+	)
+	nodeMemoryOversubscribed = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_memory_oversubscribed_bytes"),
+		"Amount of memory the running allocations may use beyond the allocatable memory of the node in bytes.",
+		[]string{"node", "datacenter"}, nil,
+	)
+	nodeReservedPorts = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_reserved_ports"),
+		"How many host ports are reserved on the node.",
+		[]string{"node", "datacenter"}, nil,
+	)
+	nodeUsedCPU = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "node_used_cpu_megahertz"),
+		"Amount of CPU used on the node in MHz.",
+		[]string{"node", "datacenter"}, nil,
+	)
+
+	allocation = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation"),
+		"Allocation labeled with runtime information.",
+		[]string{"status", "job_type", "job_id", "job_version", "task_group", "node"}, nil,
+	)
+	zombieAllocations = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "zombie_allocations"),
+		"Allocations placed on nodes that don't exist anymore, by job, missing node and desired status.",
+		[]string{"job_id", "node_id", "desired_status"}, nil,
+	)
+	allocationPendingStale = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "allocation_pending_stale"),
+		"How many allocations have been pending for longer than the pending threshold.",
+		[]string{"job_id", "node"}, nil,
+	)
+	gcEligibleAllocations = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "gc_eligible", "allocations"),
+		"How many allocations are terminal and will be garbage collected once older than the GC threshold.",
+		nil, nil,
+	)
+	gcEligibleJobs = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "gc_eligible", "jobs"),
+		"How many jobs are dead and will be garbage collected once older than the GC threshold.",
+		nil, nil,
+	)
+	gcEligibleEvals = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "gc_eligible", "evals"),
+		"How many evaluations are terminal and will be garbage collected once older than the GC threshold.",
+		nil, nil,
+	)
+	evalsPending = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "evals", "pending"),
+		"How many evaluations are pending, waiting for a scheduler.",
+		nil, nil,
+	)
+	deploymentsActive = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "deployments", "active"),
+		"How many deployments are active, running or paused.",
+		nil, nil,
+	)
+	blockedEvalsExhausted = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "blocked_evals", "exhausted"),
+		"How many task groups of blocked evaluations couldn't be placed because the nodes ran out of the resource, or were filtered out by constraints.",
+		[]string{"dimension"}, nil,
+	)
+	blockedEvalsClassExhausted = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "blocked_evals", "class_exhausted"),
+		"How many task groups of blocked evaluations couldn't be placed because the nodes of the class ran out of resources.",
+		[]string{"node_class"}, nil,
+	)
+	evalCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "evals_total"),
+		"The number of evaluations.",
+		[]string{"status"}, nil,
+	)
+	evalWaitSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "eval_wait_seconds",
+		Help:      "How long evaluations were delayed before being processed, by scheduler type.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 12),
+	},
+		[]string{"type"},
+	)
+	evalProcessingSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "eval_processing_seconds",
+		Help:      "How long evaluations took from being ready to being done, by scheduler type.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+	},
+		[]string{"type"},
+	)
+	taskCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "tasks_total"),
+		"The number of tasks.",
+		[]string{"state", "job_type", "node", "driver", "lifecycle"}, nil,
+	)
+
+	deploymentCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "deployments_total"),
+		"The number of deployments.",
+		[]string{"status", "job_id", "job_version"}, nil,
+	)
+
+	allocationsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "allocations_failed_total",
+		Help:      "The number of allocations that failed since the exporter started.",
+	},
+		[]string{"job", "task_group"},
+	)
+	deploymentFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deployment_failed_total",
+		Help:      "The number of deployments that failed since the exporter started.",
+	},
+		[]string{"job_id"},
+	)
+	deploymentAutoReverted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deployment_auto_reverted_total",
+		Help:      "The number of failed deployments that were auto reverted since the exporter started.",
+	},
+		[]string{"job_id"},
+	)
+
+	deploymentTaskGroupDesiredCanaries = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "deployment_task_group_desired_canaries_total"),
+		"The number of desired canaries for the task group.",
+		[]string{"status", "job_id", "job_version", "task_group", "promoted", "auto_revert"}, nil,
+	)
+
+	deploymentTaskGroupDesiredTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "deployment_task_group_desired_total"),
+		"The number of desired allocs for the task group.",
+		[]string{"status", "job_id", "job_version", "task_group", "promoted", "auto_revert"}, nil,
+	)
+
+	deploymentTaskGroupPlacedAllocs = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "deployment_task_group_placed_allocs_total"),
+		"The number of placed allocs for the task group.",
+		[]string{"status", "job_id", "job_version", "task_group", "promoted", "auto_revert"}, nil,
+	)
+
+	deploymentTaskGroupHealthyAllocs = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "deployment_task_group_healthy_allocs_total"),
+		"The number of healthy allocs for the task group.",
+		[]string{"status", "job_id", "job_version", "task_group", "promoted", "auto_revert"}, nil,
+	)
+
+	deploymentTaskGroupUnhealthyAllocs = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "deployment_task_group_unhealthy_allocs_total"),
+		"the number of unhealthy allocs for the task group",
+		[]string{"status", "job_id", "job_version", "task_group", "promoted", "auto_revert"}, nil,
+	)
+
+	apiLatencySummary = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_latency_seconds",
+		Help:      "nomad api latency for different queries",
+		Buckets:   prometheus.ExponentialBuckets(0.00025, 2, 12),
+	},
+		[]string{
+			"query",
+		})
+	apiNodeLatencySummary = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_node_latency_seconds",
+		Help:      "nomad api latency for different nodes and queries",
+		Buckets:   prometheus.ExponentialBuckets(0.00025, 2, 12),
+	},
+		[]string{
+			"node",
+			"query",
+		})
+)
+
+var minVersion *go_ver.Version
+
+func init() {
+	m, err := go_ver.NewVersion("0.8")
+	if err != nil {
+		logrus.Fatalf("failed to parse the minimum version: %s", err)
+	}
+	minVersion = m
+}
+
+// LogError logs the error and counts it in nomad_client_errors_total
+func LogError(err error) {
+	clientErrors.Inc()
+	logrus.Error(err)
+}
+
+// LatencyCollectors returns the nomad api latency histograms, to serve them
+// apart from the nomad metrics
+func LatencyCollectors() []prometheus.Collector {
+	return []prometheus.Collector{apiLatencySummary, apiNodeLatencySummary}
+}
+
+func validVersion(name, ver string) bool {
+	nodeVersion, err := go_ver.NewVersion(ver)
+	if err != nil {
+		logrus.Errorf("can't parse node %s version %s: %s", name, ver, err)
+		return false
+	}
+	if nodeVersion.LessThan(minVersion) {
+		logrus.Debugf("Skipping node %s because it has version %s", name, ver)
+		return false
+	}
+	return true
+}
+
+func measure(query string, f func() error) error {
+	o := newLatencyObserver(query)
+	err := f()
+	o.observe()
+	return err
+}
+
+type latencyObserver struct {
+	startTime time.Time
+	node      string
+	query     string
+}
+
+func newLatencyObserver(query string) latencyObserver {
+	return latencyObserver{
+		node:      "",
+		query:     query,
+		startTime: time.Now(),
+	}
+}
+
+func newNodeLatencyObserver(node, query string) latencyObserver {
+	return latencyObserver{
+		node:      node,
+		query:     query,
+		startTime: time.Now(),
+	}
+}
+
+func (n latencyObserver) observe() {
+	duration := time.Since(n.startTime)
+
+	if n.node == "" {
+		apiLatencySummary.WithLabelValues(n.query).Observe(duration.Seconds())
+		logrus.Debugf("Duration for query %s: %f", n.query, duration.Seconds())
+	} else {
+		apiNodeLatencySummary.WithLabelValues(n.node, n.query).Observe(duration.Seconds())
+		logrus.Debugf("Duration for node %s, query %s: %f", n.query, n.node, duration.Seconds())
+	}
+}
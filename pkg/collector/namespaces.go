@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// listNamespaced calls list with the query options of the collector, once
+// for every namespace when the namespaces are listed apart, so a namespace
+// that fails or times out doesn't fail the others. It only fails when every
+// namespace does, the namespace is empty when they aren't listed apart
+func (e *Exporter) listNamespaced(collector string, list func(namespace string, q *api.QueryOptions) error) error {
+	if e.namespacePool == nil {
+		return list("", e.queryOptions(collector))
+	}
+
+	o := newLatencyObserver("get_namespaces")
+	namespaces, _, err := e.client.Namespaces().List(e.queryOptions(collector))
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("could not get namespaces: %s", err)
+	}
+
+	var w sync.WaitGroup
+	var mu sync.Mutex
+	var failures int
+	var last error
+	for _, ns := range namespaces {
+		name := ns.Name
+		e.namespacePool.Go(&w, func() {
+			q := e.queryOptions(collector)
+			q.Namespace = name
+			if err := list(name, q); err != nil {
+				LogError(fmt.Errorf("could not list %s of namespace %s: %s", collector, name, err))
+				namespaceErrors.WithLabelValues(collector, name).Inc()
+
+				mu.Lock()
+				failures++
+				last = err
+				mu.Unlock()
+			}
+		})
+	}
+	w.Wait()
+
+	if len(namespaces) > 0 && failures == len(namespaces) {
+		return fmt.Errorf("could not list %s of any namespace: %s", collector, last)
+	}
+	return nil
+}
+
+// listAllocations lists the allocations of the namespaces
+func (e *Exporter) listAllocations() ([]*api.AllocationListStub, error) {
+	var mu sync.Mutex
+	var allocs []*api.AllocationListStub
+	err := e.listNamespaced("allocations", func(_ string, q *api.QueryOptions) error {
+		var stubs []*api.AllocationListStub
+		if err := e.queryPages("/v1/allocations", &stubs, q); err != nil {
+			return err
+		}
+		mu.Lock()
+		allocs = append(allocs, stubs...)
+		mu.Unlock()
+		return nil
+	})
+	return allocs, err
+}
+
+// listEvaluations lists the evaluations of the namespaces
+func (e *Exporter) listEvaluations() ([]*evaluation, error) {
+	var mu sync.Mutex
+	var evals []*evaluation
+	err := e.listNamespaced("evals", func(_ string, q *api.QueryOptions) error {
+		var list []*evaluation
+		if err := e.queryPages("/v1/evaluations", &list, q); err != nil {
+			return err
+		}
+		mu.Lock()
+		evals = append(evals, list...)
+		mu.Unlock()
+		return nil
+	})
+	return evals, err
+}
+
+// listDeployments lists the deployments of the namespaces
+func (e *Exporter) listDeployments() ([]*api.Deployment, error) {
+	var mu sync.Mutex
+	var deployments []*api.Deployment
+	err := e.listNamespaced("deployments", func(_ string, q *api.QueryOptions) error {
+		list, _, err := e.client.Deployments().List(q)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		deployments = append(deployments, list...)
+		mu.Unlock()
+		return nil
+	})
+	return deployments, err
+}
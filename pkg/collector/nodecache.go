@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// nodeCache keeps the nodes between collections, a node is only fetched
+// again when its modify index changes as node definitions rarely do
+type nodeCache struct {
+	mu      sync.Mutex
+	nodes   map[string]*api.Node
+	changed bool
+}
+
+func newNodeCache() *nodeCache {
+	return &nodeCache{
+		nodes: make(map[string]*api.Node),
+	}
+}
+
+// get returns the cached node if it's still at the modify index of the stub
+func (c *nodeCache) get(stub api.NodeListStub) (*api.Node, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, ok := c.nodes[stub.ID]
+	if !ok || n.ModifyIndex != stub.ModifyIndex {
+		return nil, false
+	}
+	return n, true
+}
+
+func (c *nodeCache) put(n *api.Node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nodes[n.ID] = n
+	c.changed = true
+}
+
+// prune forgets the nodes that are no longer in the cluster
+func (c *nodeCache) prune(nodes nodeMap) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id := range c.nodes {
+		if _, ok := nodes[id]; !ok {
+			delete(c.nodes, id)
+			c.changed = true
+		}
+	}
+}
+
+// nodeInfo returns the node of the stub, from the cache when it didn't
+// change since it was last fetched
+func (e *Exporter) nodeInfo(stub api.NodeListStub) (*api.Node, error) {
+	if n, ok := e.nodeCache.get(stub); ok {
+		return n, nil
+	}
+
+	o := newNodeLatencyObserver(stub.Name, "fetch_node")
+	n, _, err := e.client.Nodes().Info(stub.ID, e.queryOptions("nodes"))
+	o.observe()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get node %s info: %s", stub.Name, err)
+	}
+	e.nodeCache.put(n)
+	return n, nil
+}
@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"github.com/hashicorp/nomad/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// nodeEventSubsystemCluster is the subsystem of the events nomad records
+	// when a node registers and misses or resumes heartbeating
+	nodeEventSubsystemCluster = "Cluster"
+	nodeEventHeartbeatMissed  = "Node heartbeat missed"
+)
+
+// collectNodeStatusChange exports when the status of the node last changed,
+// from its latest cluster event or when the servers last updated it, and how
+// many of the events nomad keeps are missed heartbeats, which tells a
+// flapping node from one that went down once
+func collectNodeStatusChange(n *api.Node, ch chan<- prometheus.Metric) {
+	changed := float64(n.StatusUpdatedAt)
+	var missed int
+	for _, event := range n.Events {
+		if event.Subsystem != nodeEventSubsystemCluster {
+			continue
+		}
+		if t := float64(event.Timestamp.UnixNano()) / 1e9; t > changed {
+			changed = t
+		}
+		if event.Message == nodeEventHeartbeatMissed {
+			missed++
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		nodeStatusChanged, prometheus.GaugeValue, changed,
+		n.Name, n.ID, n.Status,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		nodeMissedHeartbeats, prometheus.GaugeValue, float64(missed),
+		n.Name, n.ID,
+	)
+}
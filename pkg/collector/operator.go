@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// schedulerConfiguration is the part of the scheduler configuration the
+// exporter reads, the api package only knows about preemption
+type schedulerConfiguration struct {
+	SchedulerConfig struct {
+		SchedulerAlgorithm            string
+		MemoryOversubscriptionEnabled bool
+		PreemptionConfig              map[string]bool
+	}
+}
+
+// collectSchedulerConfig collects the cluster wide scheduler settings, so
+// flipping them can be alerted on
+func (e *Exporter) collectSchedulerConfig(ch chan<- prometheus.Metric) error {
+	if !e.shouldReadMetrics() {
+		return nil
+	}
+
+	var c schedulerConfiguration
+	o := newLatencyObserver("get_scheduler_configuration")
+	_, err := e.client.Raw().Query("/v1/operator/scheduler/configuration", &c, e.queryOptions("peers"))
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("could not get scheduler configuration: %s", err)
+	}
+
+	// servers before 0.11 only binpack
+	algorithm := c.SchedulerConfig.SchedulerAlgorithm
+	if algorithm == "" {
+		algorithm = "binpack"
+	}
+	ch <- prometheus.MustNewConstMetric(
+		schedulerConfigInfo, prometheus.GaugeValue, 1, algorithm,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		schedulerMemoryOversubscription, prometheus.GaugeValue,
+		boolToFloat(c.SchedulerConfig.MemoryOversubscriptionEnabled),
+	)
+
+	// SystemSchedulerEnabled, BatchSchedulerEnabled and so on
+	for key, enabled := range c.SchedulerConfig.PreemptionConfig {
+		scheduler := strings.TrimSuffix(key, "SchedulerEnabled")
+		if scheduler == key {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			schedulerPreemption, prometheus.GaugeValue, boolToFloat(enabled),
+			strings.ToLower(scheduler),
+		)
+	}
+	return nil
+}
+
+// rootKey is a root encryption key as listed by the keyring of nomad 1.4
+type rootKey struct {
+	KeyID      string
+	State      string
+	CreateTime int64
+}
+
+// collectKeyringMetrics collects how many root keys there are and when the
+// active one was created, to alert when it wasn't rotated within policy
+func (e *Exporter) collectKeyringMetrics(ch chan<- prometheus.Metric) error {
+	if !e.shouldReadMetrics() {
+		return nil
+	}
+
+	var keys []rootKey
+	o := newLatencyObserver("get_keyring_keys")
+	_, err := e.client.Raw().Query("/v1/operator/keyring/keys", &keys, e.queryOptions("keyring"))
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("could not get keyring keys: %s", err)
+	}
+
+	states := make(map[string]int)
+	for _, key := range keys {
+		states[key.State]++
+
+		if key.State == "active" {
+			ch <- prometheus.MustNewConstMetric(
+				keyringActiveKeyCreateTime, prometheus.GaugeValue, float64(key.CreateTime)/1e9,
+				key.KeyID,
+			)
+		}
+	}
+	for state, count := range states {
+		ch <- prometheus.MustNewConstMetric(
+			keyringKeys, prometheus.GaugeValue, float64(count), state,
+		)
+	}
+	return nil
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// pageTokens keeps the token of the next page nomad returns for a page
+// request, as a header the api package doesn't read, until the query paging
+// through the list takes it. The pages are told apart by list, namespace and
+// token, a list isn't paged through twice at once
+type pageTokens struct {
+	next http.RoundTripper
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func newPageTokens(next http.RoundTripper) *pageTokens {
+	return &pageTokens{
+		next:   next,
+		tokens: make(map[string]string),
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *pageTokens) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	query := r.URL.Query()
+	if _, ok := query["per_page"]; ok && resp.StatusCode == http.StatusOK {
+		key := pageKey(r.URL.Path, query.Get("namespace"), query.Get("next_token"))
+		t.mu.Lock()
+		t.tokens[key] = resp.Header.Get("X-Nomad-NextToken")
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// take returns the token of the page after the one of key and forgets it
+func (t *pageTokens) take(key string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	token := t.tokens[key]
+	delete(t.tokens, key)
+	return token
+}
+
+func pageKey(path, namespace, token string) string {
+	return path + " " + namespace + " " + token
+}
+
+// queryPages queries the list at path, which may have query parameters, page
+// by page when a page size is set and whole otherwise, appending every page
+// to out, a pointer to a slice. Servers that don't paginate the list return
+// it whole on the first page
+func (e *Exporter) queryPages(path string, out interface{}, q *api.QueryOptions) error {
+	if e.PageSize <= 0 {
+		_, err := e.client.Raw().Query(path, out, q)
+		return err
+	}
+
+	list, separator := path, "?"
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		list, separator = path[:i], "&"
+	}
+	// the api sends the namespace of the client unless the query has one
+	namespace := e.ClientConfig.Namespace
+	if q != nil && q.Namespace != "" {
+		namespace = q.Namespace
+	}
+
+	all := reflect.ValueOf(out).Elem()
+	var token string
+	for {
+		params := url.Values{
+			"per_page": {strconv.Itoa(e.PageSize)},
+		}
+		if token != "" {
+			params.Set("next_token", token)
+		}
+
+		page := reflect.New(all.Type())
+		_, err := e.client.Raw().Query(path+separator+params.Encode(), page.Interface(), q)
+		next := e.pages.take(pageKey(list, namespace, token))
+		if err != nil {
+			return err
+		}
+		all.Set(reflect.AppendSlice(all, page.Elem()))
+
+		if next == "" {
+			return nil
+		}
+		token = next
+	}
+}
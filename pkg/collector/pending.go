@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// workStatus is the status of an evaluation or a deployment, the only field
+// the pending work needs decoding
+type workStatus struct {
+	Status string
+}
+
+// countActive counts the deployments that are running or paused
+func countActive(deployments []*api.Deployment) int {
+	var active int
+	for _, dep := range deployments {
+		switch dep.Status {
+		case "running", "paused":
+			active++
+		}
+	}
+	return active
+}
+
+// collectPendingWork collects how many evaluations are pending and how many
+// deployments are active when the eval or deployment collectors are off,
+// which collect them otherwise. Only the statuses are decoded, so it stays
+// cheap on installations that don't run the heavier collectors
+func (e *Exporter) collectPendingWork(ch chan<- prometheus.Metric) error {
+	if !e.shouldReadMetrics() {
+		return nil
+	}
+
+	if !e.toggles.enabled("eval") {
+		pending, err := e.countStatuses("evals", "/v1/evaluations", "pending")
+		if err != nil {
+			return fmt.Errorf("could not get pending evaluations: %s", err)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			evalsPending, prometheus.GaugeValue, float64(pending),
+		)
+	}
+
+	if !e.toggles.enabled("deployment") {
+		active, err := e.countStatuses("deployments", "/v1/deployments", "running", "paused")
+		if err != nil {
+			return fmt.Errorf("could not get active deployments: %s", err)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			deploymentsActive, prometheus.GaugeValue, float64(active),
+		)
+	}
+	return nil
+}
+
+// countStatuses counts the objects of the list at path in any of the
+// statuses, across the namespaces
+func (e *Exporter) countStatuses(collector, path string, statuses ...string) (int, error) {
+	var mu sync.Mutex
+	var count int
+	err := e.listNamespaced(collector, func(_ string, q *api.QueryOptions) error {
+		var list []workStatus
+		if err := e.queryPages(path, &list, q); err != nil {
+			return err
+		}
+
+		var n int
+		for _, item := range list {
+			for _, status := range statuses {
+				if item.Status == status {
+					n++
+				}
+			}
+		}
+		mu.Lock()
+		count += n
+		mu.Unlock()
+		return nil
+	})
+	return count, err
+}
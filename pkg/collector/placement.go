@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// placementScores remembers the scores of the nodes the scheduler considered
+// for every recent allocation, they don't change once it's placed so every
+// allocation is fetched once
+type placementScores struct {
+	mu     sync.Mutex
+	scores map[string][]*api.NodeScoreMeta
+}
+
+func (p *placementScores) get(id string) ([]*api.NodeScoreMeta, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	scores, ok := p.scores[id]
+	return scores, ok
+}
+
+func (p *placementScores) put(id string, scores []*api.NodeScoreMeta) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.scores[id] = scores
+}
+
+// prune forgets the allocations that aren't recent anymore
+func (p *placementScores) prune(recent map[string]bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for id := range p.scores {
+		if !recent[id] {
+			delete(p.scores, id)
+		}
+	}
+}
+
+// collectPlacementScores collects the scores of the nodes the scheduler
+// considered for the allocations placed within the max age, by scorer, to
+// tell why allocations end up on a few nodes. The scores are only in the
+// allocation itself, so every recent allocation is fetched once
+func (e *Exporter) collectPlacementScores(nodes nodeMap, ch chan<- prometheus.Metric) error {
+	if !e.shouldReadMetrics() {
+		return nil
+	}
+
+	o := newLatencyObserver("get_allocations")
+	allocStubs, err := e.listAllocations()
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("could not get allocations: %s", err)
+	}
+
+	var w sync.WaitGroup
+	recent := make(map[string]bool)
+	now := time.Now()
+	for _, allocStub := range allocStubs {
+		if now.Sub(time.Unix(0, allocStub.CreateTime)) > e.PlacementMaxAge {
+			continue
+		}
+		recent[allocStub.ID] = true
+
+		allocStub := *allocStub
+		e.allocationPool.Go(&w, func() {
+			scores, ok := e.placementScores.get(allocStub.ID)
+			if !ok {
+				alloc, _, err := e.client.Allocations().Info(allocStub.ID, e.queryOptions("allocations"))
+				if err != nil {
+					LogError(fmt.Errorf("could not get allocation %s: %s", allocStub.ID, err))
+					return
+				}
+				if alloc.Metrics != nil {
+					scores = alloc.Metrics.ScoreMetaData
+				}
+				e.placementScores.put(allocStub.ID, scores)
+			}
+
+			for _, score := range scores {
+				nodeName := score.NodeID
+				if n := nodes[score.NodeID]; n != nil {
+					nodeName = n.Name
+				}
+				labels := []string{
+					allocStub.JobID, allocStub.TaskGroup, allocStub.ID, nodeName,
+					strconv.FormatBool(score.NodeID == allocStub.NodeID),
+				}
+				for scorer, value := range score.Scores {
+					ch <- prometheus.MustNewConstMetric(
+						allocationPlacementScore, prometheus.GaugeValue, value,
+						append(labels, scorer)...,
+					)
+				}
+				ch <- prometheus.MustNewConstMetric(
+					allocationPlacementScore, prometheus.GaugeValue, score.NormScore,
+					append(labels, "normalized")...,
+				)
+			}
+		})
+	}
+	w.Wait()
+
+	e.placementScores.prune(recent)
+	return nil
+}
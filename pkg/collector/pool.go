@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// workerPool bounds how many calls a collector makes to the api at once.
+// The caller waits for a free worker before the call gets a goroutine, so
+// the goroutines are bounded along with the calls, and the most callers
+// waiting is exported on every collection
+type workerPool struct {
+	name  string
+	slots chan struct{}
+
+	mu     sync.Mutex
+	queued int
+	peak   int
+}
+
+func newWorkerPool(name string, size int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &workerPool{
+		name:  name,
+		slots: make(chan struct{}, size),
+	}
+}
+
+// Go waits for a free worker and runs f on it, w is done when f returns
+func (p *workerPool) Go(w *sync.WaitGroup, f func()) {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		p.wait()
+	}
+
+	w.Add(1)
+	go func() {
+		defer w.Done()
+		defer func() { <-p.slots }()
+
+		f()
+	}()
+}
+
+// wait blocks the caller until there's a free worker
+func (p *workerPool) wait() {
+	p.mu.Lock()
+	p.queued++
+	if p.queued > p.peak {
+		p.peak = p.queued
+	}
+	p.mu.Unlock()
+
+	p.slots <- struct{}{}
+
+	p.mu.Lock()
+	p.queued--
+	p.mu.Unlock()
+}
+
+// collect exports the size of the pool and the deepest its queue got since
+// the last collection
+func (p *workerPool) collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	peak := p.peak
+	p.peak = p.queued
+	p.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(
+		poolWorkers, prometheus.GaugeValue, float64(cap(p.slots)), p.name,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		poolQueueDepth, prometheus.GaugeValue, float64(peak), p.name,
+	)
+}
@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryCollectors are the collectors that accept query overrides
+var queryCollectors = []string{"nodes", "allocations", "jobs", "evals", "deployments"}
+
+// QueryConfig holds the consistency options used when querying the api
+type QueryConfig struct {
+	AllowStale bool
+	WaitTime   time.Duration
+}
+
+// ParseQueryOverrides parses a comma separated list of per collector query
+// options in the form collector=stale|consistent[:waittime in ms], options
+// that are not overridden are taken from the defaults
+func ParseQueryOverrides(spec string, defaults QueryConfig) (map[string]QueryConfig, error) {
+	overrides := make(map[string]QueryConfig)
+	if spec == "" {
+		return overrides, nil
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid query override %q, expected collector=mode[:waittime]", entry)
+		}
+
+		collector := strings.TrimSpace(parts[0])
+		if !isQueryCollector(collector) {
+			return nil, fmt.Errorf("unknown collector %q in query override, valid ones are %s",
+				collector, strings.Join(queryCollectors, ", "))
+		}
+
+		c := defaults
+		options := strings.SplitN(parts[1], ":", 2)
+		switch strings.TrimSpace(options[0]) {
+		case "stale":
+			c.AllowStale = true
+		case "consistent":
+			c.AllowStale = false
+		default:
+			return nil, fmt.Errorf("invalid query mode %q for collector %s, expected stale or consistent",
+				options[0], collector)
+		}
+
+		if len(options) == 2 {
+			ms, err := strconv.Atoi(strings.TrimSpace(options[1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid wait time %q for collector %s: %s", options[1], collector, err)
+			}
+			c.WaitTime = time.Duration(ms) * time.Millisecond
+		}
+
+		overrides[collector] = c
+	}
+	return overrides, nil
+}
+
+func isQueryCollector(name string) bool {
+	for _, c := range queryCollectors {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
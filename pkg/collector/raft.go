@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// leaderTracker remembers the leader between collections to count the
+// leadership changes
+type leaderTracker struct {
+	mu     sync.Mutex
+	leader string
+}
+
+// observe records the current leader and returns whether it changed since
+// the last call, the first call only records it
+func (l *leaderTracker) observe(leader string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if leader == "" {
+		return false
+	}
+	changed := l.leader != "" && l.leader != leader
+	if changed {
+		logrus.Infof("Leadership changed from %s to %s", l.leader, leader)
+	}
+	l.leader = leader
+	return changed
+}
+
+// collectAutopilotMetrics collects how long ago each server last heard from
+// the leader, as reported by autopilot
+func (e *Exporter) collectAutopilotMetrics(ch chan<- prometheus.Metric) error {
+	if !e.shouldReadMetrics() {
+		return nil
+	}
+
+	o := newLatencyObserver("get_autopilot_health")
+	health, _, err := e.client.Operator().AutopilotServerHealth(e.queryOptions("peers"))
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("failed to get autopilot health: %s", err)
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		autopilotHealthy, prometheus.GaugeValue, boolToFloat(health.Healthy),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		autopilotFailureTolerance, prometheus.GaugeValue, float64(health.FailureTolerance),
+	)
+	for _, s := range health.Servers {
+		ch <- prometheus.MustNewConstMetric(
+			raftLastContact, prometheus.GaugeValue, s.LastContact.Seconds(),
+			s.Name, strconv.FormatBool(s.Leader),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			autopilotServerHealthy, prometheus.GaugeValue, boolToFloat(s.Healthy),
+			s.Name, s.Version, strconv.FormatBool(s.Voter),
+		)
+	}
+
+	o = newLatencyObserver("get_autopilot_configuration")
+	config, _, err := e.client.Operator().AutopilotGetConfiguration(e.queryOptions("peers"))
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("failed to get autopilot configuration: %s", err)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		autopilotUpgradeMigration, prometheus.GaugeValue, boolToFloat(!config.DisableUpgradeMigration),
+	)
+	return nil
+}
+
+// collectRaftConfiguration collects the raft protocol every server speaks,
+// which have to agree before upgrading
+func (e *Exporter) collectRaftConfiguration(ch chan<- prometheus.Metric) error {
+	if !e.shouldReadMetrics() {
+		return nil
+	}
+
+	o := newLatencyObserver("get_raft_configuration")
+	config, err := e.client.Operator().RaftGetConfiguration(e.queryOptions("peers"))
+	o.observe()
+	if err != nil {
+		return fmt.Errorf("failed to get raft configuration: %s", err)
+	}
+
+	for _, s := range config.Servers {
+		protocol, err := strconv.ParseFloat(s.RaftProtocol, 64)
+		if err != nil {
+			logrus.Debugf("Server %s speaks unknown raft protocol %q", s.Node, s.RaftProtocol)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			raftServerProtocol, prometheus.GaugeValue, protocol,
+			s.Node, s.Address, strconv.FormatBool(s.Voter),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// nodeReserved are the resources of a node reserved for processes outside
+// of nomad
+type nodeReserved struct {
+	CPU, MemoryMB, DiskMB, Ports int
+}
+
+// reservedResources returns the reserved resources of the node, from the
+// node resources when the node reports them or the legacy resources otherwise
+func reservedResources(n *api.Node) (nodeReserved, error) {
+	var r nodeReserved
+	if rr := n.ReservedResources; rr != nil {
+		r.CPU = int(rr.Cpu.CpuShares)
+		r.MemoryMB = int(rr.Memory.MemoryMB)
+		r.DiskMB = int(rr.Disk.DiskMB)
+
+		ports, err := countPorts(rr.Networks.ReservedHostPorts)
+		if err != nil {
+			return r, fmt.Errorf("invalid reserved ports of node %s: %s", n.Name, err)
+		}
+		r.Ports = ports
+		return r, nil
+	}
+
+	if n.Reserved == nil {
+		return r, nil
+	}
+	if n.Reserved.CPU != nil {
+		r.CPU = *n.Reserved.CPU
+	}
+	if n.Reserved.MemoryMB != nil {
+		r.MemoryMB = *n.Reserved.MemoryMB
+	}
+	if n.Reserved.DiskMB != nil {
+		r.DiskMB = *n.Reserved.DiskMB
+	}
+	for _, network := range n.Reserved.Networks {
+		r.Ports += len(network.ReservedPorts)
+	}
+	return r, nil
+}
+
+// countPorts counts the ports of a spec like 22,80,8000-8100
+func countPorts(spec string) (int, error) {
+	var count int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		bounds := strings.SplitN(part, "-", 2)
+		low, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return 0, fmt.Errorf("invalid port %q", part)
+		}
+		high := low
+		if len(bounds) == 2 {
+			if high, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil || high < low {
+				return 0, fmt.Errorf("invalid port range %q", part)
+			}
+		}
+		count += high - low + 1
+	}
+	return count, nil
+}
@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scheduledCollectors are the collectors that can run less often than the
+// collections
+var scheduledCollectors = []string{
+	"allocations", "broker", "deployment", "eval", "federation", "integration",
+	"jobs", "keyring", "node", "peer", "placement", "serf",
+}
+
+// ParseSchedule parses a comma separated list of collector=n, the collector
+// then runs every nth collection and its metrics are served from the last
+// run in between. Collectors that aren't listed run every collection
+func ParseSchedule(spec string) (map[string]int, error) {
+	every := make(map[string]int)
+	if spec == "" {
+		return every, nil
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid schedule %q, expected collector=n", entry)
+		}
+
+		collector := strings.TrimSpace(parts[0])
+		i := sort.SearchStrings(scheduledCollectors, collector)
+		if i == len(scheduledCollectors) || scheduledCollectors[i] != collector {
+			return nil, fmt.Errorf("unknown collector %q in schedule, valid ones are %s",
+				collector, strings.Join(scheduledCollectors, ", "))
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid schedule %q for collector %s, expected a positive number", parts[1], collector)
+		}
+		every[collector] = n
+	}
+	return every, nil
+}
+
+// scheduledRun is the metrics a collector sent the last time it ran
+type scheduledRun struct {
+	round   int
+	metrics []prometheus.Metric
+}
+
+// schedule runs the collectors every nth collection and keeps what they sent
+// to serve it again in between. A failed run isn't kept, so the collector
+// runs again the next collection. A nil schedule runs every collector every
+// time
+type schedule struct {
+	every map[string]int
+
+	mu     sync.Mutex
+	round  int
+	runs   map[string]*scheduledRun
+	cached map[string]bool
+}
+
+func newSchedule(every map[string]int) *schedule {
+	return &schedule{
+		every:  every,
+		runs:   make(map[string]*scheduledRun),
+		cached: make(map[string]bool),
+	}
+}
+
+// tick starts a collection
+func (s *schedule) tick() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.round++
+	s.cached = make(map[string]bool)
+}
+
+// reset forgets what the collectors sent, so they all run next time
+func (s *schedule) reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs = make(map[string]*scheduledRun)
+}
+
+// run runs the collector when it's due, or sends what it sent last time
+// otherwise, returning whether it ran. A collector may be made of several
+// runs, kept apart by name
+func (s *schedule) run(collector, name string, ch chan<- prometheus.Metric,
+	collect func(chan<- prometheus.Metric) error) (bool, error) {
+	if s == nil || s.every[collector] <= 1 {
+		return true, collect(ch)
+	}
+
+	s.mu.Lock()
+	last := s.runs[name]
+	round := s.round
+	if last != nil && round-last.round < s.every[collector] {
+		s.cached[collector] = true
+		s.mu.Unlock()
+		for _, m := range last.metrics {
+			ch <- m
+		}
+		return false, nil
+	}
+	s.cached[collector] = false
+	s.mu.Unlock()
+
+	tee := make(chan prometheus.Metric)
+	done := make(chan []prometheus.Metric)
+	go func() {
+		var metrics []prometheus.Metric
+		for m := range tee {
+			ch <- m
+			metrics = append(metrics, m)
+		}
+		done <- metrics
+	}()
+	err := collect(tee)
+	close(tee)
+	metrics := <-done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		delete(s.runs, name)
+		return true, err
+	}
+	s.runs[name] = &scheduledRun{round: round, metrics: metrics}
+	return true, nil
+}
+
+// collect exports whether the metrics of the collectors on a schedule that
+// ran this collection were served from an earlier one
+func (s *schedule) collect(ch chan<- prometheus.Metric) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for collector, served := range s.cached {
+		var cached float64
+		if served {
+			cached = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			collectorCached, prometheus.GaugeValue, cached, collector,
+		)
+	}
+}
@@ -0,0 +1,168 @@
+package collector
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// snapshotData is what a collection read from the api
+type snapshotData struct {
+	Time        time.Time                 `json:"time"`
+	Nodes       []*api.NodeListStub       `json:"nodes"`
+	Allocations []*api.AllocationListStub `json:"allocations"`
+	Jobs        []*api.JobListStub        `json:"jobs"`
+	Deployments []*api.Deployment         `json:"deployments"`
+}
+
+// snapshot keeps the lists the last complete collection read, to serve them
+// as json for debugging and for tooling that doesn't parse the metrics. The
+// lists of a collection are gathered apart and only replace the served ones
+// once it's done. The lists of the disabled collectors stay empty, as do all
+// of them while the metrics are suppressed. A nil snapshot keeps nothing
+type snapshot struct {
+	mu      sync.RWMutex
+	current *snapshotData
+	pending *snapshotData
+}
+
+// begin starts gathering the lists of a collection
+func (s *snapshot) begin() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = &snapshotData{Time: time.Now()}
+}
+
+// commit serves the lists of the collection
+func (s *snapshot) commit() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current, s.pending = s.pending, nil
+}
+
+// carry keeps the list of the collector from the last collection, for the
+// collectors that didn't run this time
+func (s *snapshot) carry(collector string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil || s.current == nil {
+		return
+	}
+	switch collector {
+	case "node":
+		s.pending.Nodes = s.current.Nodes
+	case "allocations":
+		s.pending.Allocations = s.current.Allocations
+	case "jobs":
+		s.pending.Jobs = s.current.Jobs
+	case "deployment":
+		s.pending.Deployments = s.current.Deployments
+	}
+}
+
+// update records a list read by the collection
+func (s *snapshot) update(f func(*snapshotData)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending != nil {
+		f(s.pending)
+	}
+}
+
+// Relabel rewrites the labels of a series of the metric family, the labels
+// missing from what it returns are dropped
+type Relabel func(family string, labels map[string]string) map[string]string
+
+// snapshotLabels are the fields of an item of the snapshot that are labels of
+// a metric family, by label
+type snapshotLabels struct {
+	family string
+	fields map[string]*string
+}
+
+// relabel returns a copy of the lists whose fields are rewritten as the labels
+// of the metric family the list backs, so the snapshot doesn't show what the
+// metrics don't
+func (d *snapshotData) relabel(relabel Relabel) *snapshotData {
+	c := &snapshotData{Time: d.Time}
+	var items []snapshotLabels
+	for _, n := range d.Nodes {
+		n := *n
+		c.Nodes = append(c.Nodes, &n)
+		items = append(items, snapshotLabels{"nomad_node_info", map[string]*string{
+			"name": &n.Name, "node_id": &n.ID, "datacenter": &n.Datacenter, "class": &n.NodeClass,
+			"status": &n.Status, "version": &n.Version, "scheduling_eligibility": &n.SchedulingEligibility,
+		}})
+	}
+	for _, a := range d.Allocations {
+		a := *a
+		c.Allocations = append(c.Allocations, &a)
+		items = append(items, snapshotLabels{"nomad_allocation", map[string]*string{
+			"status": &a.ClientStatus, "job_type": &a.JobType, "job_id": &a.JobID,
+			"task_group": &a.TaskGroup, "node": &a.NodeName,
+		}})
+	}
+	for _, j := range d.Jobs {
+		j := *j
+		c.Jobs = append(c.Jobs, &j)
+		items = append(items, snapshotLabels{"nomad_job_status", map[string]*string{
+			"job_id": &j.ID, "type": &j.Type, "status": &j.Status,
+		}})
+	}
+	for _, dep := range d.Deployments {
+		dep := *dep
+		c.Deployments = append(c.Deployments, &dep)
+		items = append(items, snapshotLabels{"nomad_deployments_total", map[string]*string{
+			"job_id": &dep.JobID, "status": &dep.Status,
+		}})
+	}
+
+	for _, item := range items {
+		labels := make(map[string]string, len(item.fields))
+		for label, field := range item.fields {
+			labels[label] = *field
+		}
+		labels = relabel(item.family, labels)
+		for label, field := range item.fields {
+			*field = labels[label]
+		}
+	}
+	return c
+}
+
+// snapshotHandler serves the lists of the last collection as json
+type snapshotHandler struct {
+	snapshot *snapshot
+	relabel  Relabel
+}
+
+func (h *snapshotHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	h.snapshot.mu.RLock()
+	data := h.snapshot.current
+	h.snapshot.mu.RUnlock()
+
+	if data == nil {
+		http.Error(w, "no collection yet", http.StatusServiceUnavailable)
+		return
+	}
+	if h.relabel != nil {
+		data = data.relabel(h.relabel)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
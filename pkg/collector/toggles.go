@@ -0,0 +1,238 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// collectorToggles tells which collectors run. They start as the flags say
+// and can be switched on and off at runtime through the admin API, to
+// relieve the API during an incident without a restart
+type collectorToggles struct {
+	mu        sync.RWMutex
+	defaults  map[string]bool
+	overrides map[string]bool
+}
+
+func newCollectorToggles(defaults map[string]bool) *collectorToggles {
+	return &collectorToggles{
+		defaults:  defaults,
+		overrides: make(map[string]bool),
+	}
+}
+
+func (t *collectorToggles) enabled(name string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if enabled, ok := t.overrides[name]; ok {
+		return enabled
+	}
+	return t.defaults[name]
+}
+
+// set overrides whether the collector runs
+func (t *collectorToggles) set(name string, enabled bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.defaults[name]; !ok {
+		return fmt.Errorf("unknown collector %q, expected one of %s", name, strings.Join(t.names(), ", "))
+	}
+	t.overrides[name] = enabled
+	return nil
+}
+
+// skip switches the collector off until it's switched on through the admin
+// API, reset keeps it off
+func (t *collectorToggles) skip(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.defaults[name]; ok {
+		t.defaults[name] = false
+	}
+}
+
+// reset makes the collector run as the flags say again
+func (t *collectorToggles) reset(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.defaults[name]; !ok {
+		return fmt.Errorf("unknown collector %q, expected one of %s", name, strings.Join(t.names(), ", "))
+	}
+	delete(t.overrides, name)
+	return nil
+}
+
+// state returns whether every collector runs
+func (t *collectorToggles) state() map[string]bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	state := make(map[string]bool, len(t.defaults))
+	for name, enabled := range t.defaults {
+		state[name] = enabled
+	}
+	for name, enabled := range t.overrides {
+		state[name] = enabled
+	}
+	return state
+}
+
+func (t *collectorToggles) names() []string {
+	names := make([]string, 0, len(t.defaults))
+	for name := range t.defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	nodeResourceFamilies = []*prometheus.Desc{
+		nodeResourceMemory, nodeAllocatedMemory, nodeUsedMemory, nodeResourceCPU,
+		nodeResourceIOPS, nodeResourceDiskBytes, nodeAllocatedCPU, nodeUsedCPU,
+		nodeMemoryBytes, nodeCPUPercent, nodeDiskSizeBytes, nodeDiskUsedBytes,
+		nodeDiskAvailableBytes, nodeDiskInodesUsedPercent, nodeReservedCPU,
+		nodeReservedMemory, nodeReservedDiskBytes, nodeReservedPorts, nodeMemoryOversubscribed,
+	}
+	allocatedTotalFamilies = []*prometheus.Desc{
+		datacenterAllocatedCPU, datacenterAllocatedMemory, regionAllocatedCPU, regionAllocatedMemory,
+		jobCost,
+	}
+	allocationStatsFamilies = []*prometheus.Desc{
+		allocationMemoryBytes, allocationMemoryBytesRequired, allocationMemoryStatBytes,
+		allocationCPURequired, allocationCPUPercent, allocationCPUTicks, allocationCPUUserMode,
+		allocationCPUSystemMode, allocationCPUThrottled, allocationCPUTicksTotal,
+		allocationCPUUserModeTotal, allocationCPUSystemModeTotal, allocationCPUThrottledTotal,
+		taskMemoryStatBytes, taskMemoryRssBytes, taskCPUTotalTicks, taskCPUTicksTotal, taskCPUPercent,
+		nodeOtherAllocations, nodeOtherAllocationsCPUPercent, nodeOtherAllocationsMemoryBytes,
+		groupAllocations, groupCPUPercent, groupCPURequired, groupMemoryBytes,
+		groupMemoryStatBytes, groupMemoryBytesRequired,
+	}
+)
+
+// collectorFamilies are the families every collector feeds, a family fed by
+// nested collectors is listed under each of them. The families the
+// collectors that always run feed too are left out
+var collectorFamilies = map[string][]*prometheus.Desc{
+	"peer": {
+		clusterServers, raftLastContact, raftServerProtocol, autopilotHealthy,
+		autopilotFailureTolerance, autopilotServerHealthy, autopilotUpgradeMigration,
+		serverVersion, serverMemberStatus, serverMemberProtocol,
+		schedulerConfigInfo, schedulerMemoryOversubscription, schedulerPreemption,
+	},
+	"serf": {
+		raftAppliedIndex, raftCommitIndex, raftFsmPending, raftLastLogIndex,
+		raftLastSnapshotIndex, raftNumPeers,
+	},
+	"node": concatDescs([]*prometheus.Desc{
+		nodeInfo, nodeEligible, serfLanMembers, serfLanMembersStatus, nodeStatusInfo,
+		nodeStatusChanged, nodeMissedHeartbeats, nodeCost,
+		datacenterNodes, datacenterAllocatableCPU, datacenterAllocatableMemory,
+		regionNodeCount, regionAllocatableCPU, regionAllocatableMemory,
+	}, nodeResourceFamilies, allocatedTotalFamilies),
+	"jobs": {
+		jobsTotal, jobsCount, jobPriority, jobStatus, jobSubmitTime, jobChildren,
+		jobAllocationsDesired, jobAllocationsRunning, jobGroupCount, jobGroupRequestedCPU,
+		jobGroupRequestedMemory, jobGroupRequestedMemoryMax, jobGroupRequestedDisk,
+		jobTasks, jobTaskIntegrations, jobBatchAllocations, jobBatchLastComplete,
+		jobPeriodicNextLaunch, gcEligibleJobs,
+	},
+	"allocations": concatDescs([]*prometheus.Desc{
+		allocation, allocationZombies, zombieAllocations, allocationPendingStale,
+		gcEligibleAllocations, taskCount, allocationDeploymentHealthy, allocationPortInfo,
+		allocationCreateTimestamp, allocationModifyTimestamp, taskStartedTimestamp,
+		taskFinishedTimestamp, taskLastExitCode, taskLastExitSignal, taskLastExitOOMKilled,
+	}, allocationStatsFamilies, collectorDescs(allocationsFailed)),
+	"eval": concatDescs([]*prometheus.Desc{
+		evalCount, gcEligibleEvals, blockedEvalsExhausted, blockedEvalsClassExhausted,
+	}, collectorDescs(evalWaitSeconds, evalProcessingSeconds)),
+	"deployment": concatDescs([]*prometheus.Desc{
+		deploymentCount, deploymentTaskGroupDesiredCanaries, deploymentTaskGroupDesiredTotal,
+		deploymentTaskGroupPlacedAllocs, deploymentTaskGroupHealthyAllocs,
+		deploymentTaskGroupUnhealthyAllocs,
+	}, collectorDescs(deploymentFailed, deploymentAutoReverted)),
+	"integration": {
+		vaultUp, vaultTokenTTL, consulSyncFailures,
+	},
+	"broker": {
+		brokerEvals, brokerSchedulerEvals, planQueueDepth, planOperationCount,
+		planOperationMean, planOperationMax, planRejections, planNodeRejections,
+	},
+	"allocation-stats": concatDescs(nodeResourceFamilies, allocatedTotalFamilies, allocationStatsFamilies),
+	"keyring": {
+		keyringKeys, keyringActiveKeyCreateTime,
+	},
+	"placement": {
+		allocationPlacementScore,
+	},
+	"federation": {
+		regionUp, regionNodes, regionJobs,
+	},
+}
+
+func concatDescs(lists ...[]*prometheus.Desc) []*prometheus.Desc {
+	var descs []*prometheus.Desc
+	for _, list := range lists {
+		descs = append(descs, list...)
+	}
+	return descs
+}
+
+func collectorDescs(collectors ...prometheus.Collector) []*prometheus.Desc {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		for _, c := range collectors {
+			c.Describe(ch)
+		}
+		close(ch)
+	}()
+
+	var descs []*prometheus.Desc
+	for desc := range ch {
+		descs = append(descs, desc)
+	}
+	return descs
+}
+
+var descName = regexp.MustCompile(`fqName: "([^"]+)"`)
+
+// FamilyName returns the name of the family of the desc, which the desc
+// doesn't export
+func FamilyName(desc *prometheus.Desc) string {
+	if m := descName.FindStringSubmatch(desc.String()); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// SkipFamilies switches off the collectors whose families are all switched
+// off, so their api calls are skipped. They can still be switched on through
+// the admin API
+func (e *Exporter) SkipFamilies(disabled map[string]bool) {
+	for name, descs := range collectorFamilies {
+		if name == "jobs" && e.jobMeta != nil {
+			descs = append(descs[:len(descs):len(descs)], e.jobMeta.desc)
+		}
+		skipped := true
+		for _, desc := range descs {
+			if !disabled[FamilyName(desc)] {
+				skipped = false
+				break
+			}
+		}
+		if skipped {
+			logrus.Infof("Skipping the %s collector because its metric families are all switched off", name)
+			e.toggles.skip(name)
+		}
+	}
+}
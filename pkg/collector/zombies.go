@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// zombieAllocation is an allocation placed on a node nomad doesn't know
+// about anymore
+type zombieAllocation struct {
+	ID            string `json:"id"`
+	JobID         string `json:"job_id"`
+	NodeID        string `json:"node_id"`
+	DesiredStatus string `json:"desired_status"`
+	ClientStatus  string `json:"client_status"`
+}
+
+// zombieList keeps the zombie allocations found by the last collection to
+// serve them on the debug endpoint
+type zombieList struct {
+	mu       sync.RWMutex
+	allocs   []zombieAllocation
+	recorded bool
+}
+
+// set replaces the zombie allocations and returns the ones that weren't
+// there on the last call, the first call only records them
+func (z *zombieList) set(allocs []zombieAllocation) []zombieAllocation {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	var appeared []zombieAllocation
+	if z.recorded {
+		known := make(map[string]bool, len(z.allocs))
+		for _, alloc := range z.allocs {
+			known[alloc.ID] = true
+		}
+		for _, alloc := range allocs {
+			if !known[alloc.ID] {
+				appeared = append(appeared, alloc)
+			}
+		}
+	}
+	z.allocs, z.recorded = allocs, true
+	return appeared
+}
+
+// ServeHTTP lists the zombie allocations as json
+func (z *zombieList) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	z.mu.RLock()
+	allocs := z.allocs
+	z.mu.RUnlock()
+
+	if allocs == nil {
+		allocs = []zombieAllocation{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(allocs)
+}
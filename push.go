@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// pushgatewaySink pushes the metrics to a Pushgateway compatible endpoint,
+// grouped by the exporter hostname
+type pushgatewaySink struct {
+	url      string
+	job      string
+	grouping map[string]string
+}
+
+func newPushgatewaySink(url, job string) *pushgatewaySink {
+	return &pushgatewaySink{
+		url:      url,
+		job:      job,
+		grouping: push.HostnameGroupingKey(),
+	}
+}
+
+func (p *pushgatewaySink) String() string {
+	return fmt.Sprintf("pushgateway %s", p.url)
+}
+
+// Push implements sink
+func (p *pushgatewaySink) Push(mfs []*dto.MetricFamily) error {
+	return push.FromGatherer(p.job, p.grouping, p.url, prometheus.GathererFunc(
+		func() ([]*dto.MetricFamily, error) {
+			return mfs, nil
+		}))
+}
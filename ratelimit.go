@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tokenBucket allows rate requests per second on average, with bursts of
+// up to a second worth of requests
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	burst := math.Max(1, math.Ceil(rate))
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long to wait until it's available
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// rateLimitTransport holds the requests to nomad back to the rate of the
+// bucket, whichever collector makes them
+type rateLimitTransport struct {
+	next   http.RoundTripper
+	bucket *tokenBucket
+}
+
+func withRateLimitTransport(c *http.Client, rate float64) {
+	c.Transport = &rateLimitTransport{
+		next:   c.Transport,
+		bucket: newTokenBucket(rate),
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *rateLimitTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	wait := t.bucket.reserve()
+	rateLimitWait.Observe(wait.Seconds())
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+	}
+	return t.next.RoundTrip(r)
+}
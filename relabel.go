@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
+)
+
+// Relabel rule actions
+const (
+	relabelDrop      = "drop"
+	relabelReplace   = "replace"
+	relabelLowercase = "lowercase"
+)
+
+// relabelRule drops or rewrites a label of the series of the metric families
+// matching the metric regex, or all of them when it's empty
+type relabelRule struct {
+	Action      string `json:"action"`
+	Metric      string `json:"metric"`
+	Label       string `json:"label"`
+	Regex       string `json:"regex"`
+	Replacement string `json:"replacement"`
+
+	metric *regexp.Regexp
+	regex  *regexp.Regexp
+}
+
+// loadRelabelRules reads the JSON list of relabel rules from path
+func loadRelabelRules(path string) ([]*relabelRule, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read relabel config: %s", err)
+	}
+
+	var rules []*relabelRule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("could not parse relabel config %s: %s", path, err)
+	}
+	for i, r := range rules {
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("invalid relabel rule %d in %s: %s", i, path, err)
+		}
+	}
+	return rules, nil
+}
+
+func (r *relabelRule) compile() error {
+	switch r.Action {
+	case relabelDrop, relabelLowercase:
+	case relabelReplace:
+		if r.Regex == "" {
+			return fmt.Errorf("replace needs a regex")
+		}
+	default:
+		return fmt.Errorf("unknown action %q, expected drop, replace or lowercase", r.Action)
+	}
+	if r.Label == "" {
+		return fmt.Errorf("no label")
+	}
+
+	// an empty metric would only match an empty name
+	metric := r.Metric
+	if metric == "" {
+		metric = ".*"
+	}
+	var err error
+	if r.metric, err = regexp.Compile("^(?:" + metric + ")$"); err != nil {
+		return fmt.Errorf("invalid metric regex: %s", err)
+	}
+	if r.regex, err = regexp.Compile("^(?:" + r.Regex + ")$"); err != nil {
+		return fmt.Errorf("invalid regex: %s", err)
+	}
+	return nil
+}
+
+// apply rewrites the labels of a series, returning them in their new order
+func (r *relabelRule) apply(labels []*dto.LabelPair) []*dto.LabelPair {
+	for i, l := range labels {
+		if l.GetName() != r.Label {
+			continue
+		}
+
+		switch r.Action {
+		case relabelDrop:
+			return append(labels[:i:i], labels[i+1:]...)
+		case relabelLowercase:
+			l.Value = proto.String(strings.ToLower(l.GetValue()))
+		case relabelReplace:
+			if r.regex.MatchString(l.GetValue()) {
+				l.Value = proto.String(r.regex.ReplaceAllString(l.GetValue(), r.Replacement))
+			}
+		}
+		return labels
+	}
+	return labels
+}
+
+// relabelGatherer applies the relabel rules to the gathered series. Series
+// that end up with the same labels after dropping one are merged, adding up
+// their values
+func relabelGatherer(g prometheus.Gatherer, rules []*relabelRule) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		for _, mf := range mfs {
+			var matching []*relabelRule
+			for _, r := range rules {
+				if r.metric.MatchString(mf.GetName()) {
+					matching = append(matching, r)
+				}
+			}
+			if len(matching) == 0 {
+				continue
+			}
+
+			seen := make(map[string]*dto.Metric)
+			metrics := mf.Metric[:0]
+			for _, m := range mf.Metric {
+				for _, r := range matching {
+					m.Label = r.apply(m.Label)
+				}
+
+				key := seriesKey(m.Label)
+				if first, ok := seen[key]; ok {
+					mergeMetric(first, m)
+					continue
+				}
+				seen[key] = m
+				metrics = append(metrics, m)
+			}
+			mf.Metric = metrics
+		}
+		return mfs, err
+	})
+}
+
+// snapshotRelabel applies the relabel rules to the fields of the snapshot
+// items, as to the labels of the metric family they back
+func snapshotRelabel(rules []*relabelRule) collector.Relabel {
+	if len(rules) == 0 {
+		return nil
+	}
+	return func(family string, labels map[string]string) map[string]string {
+		var pairs []*dto.LabelPair
+		for name, value := range labels {
+			pairs = append(pairs, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+		}
+		for _, r := range rules {
+			if r.metric.MatchString(family) {
+				pairs = r.apply(pairs)
+			}
+		}
+
+		relabeled := make(map[string]string, len(pairs))
+		for _, p := range pairs {
+			relabeled[p.GetName()] = p.GetValue()
+		}
+		return relabeled
+	}
+}
+
+func seriesKey(labels []*dto.LabelPair) string {
+	sorted := append([]*dto.LabelPair{}, labels...)
+	sort.Sort(labelPairSorter(sorted))
+
+	var key strings.Builder
+	for _, l := range sorted {
+		key.WriteString(l.GetName())
+		key.WriteByte(0)
+		key.WriteString(l.GetValue())
+		key.WriteByte(0)
+	}
+	return key.String()
+}
+
+// mergeMetric adds the value of m to into, histograms and summaries can't be
+// added up so the first series is kept
+func mergeMetric(into, m *dto.Metric) {
+	switch {
+	case into.Gauge != nil && m.Gauge != nil:
+		into.Gauge.Value = proto.Float64(into.Gauge.GetValue() + m.Gauge.GetValue())
+	case into.Counter != nil && m.Counter != nil:
+		into.Counter.Value = proto.Float64(into.Counter.GetValue() + m.Counter.GetValue())
+	case into.Untyped != nil && m.Untyped != nil:
+		into.Untyped.Value = proto.Float64(into.Untyped.GetValue() + m.Untyped.GetValue())
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// runService only runs the exporter as a service on windows
+func runService(_ args, _ func(args)) bool {
+	return false
+}
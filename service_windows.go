@@ -0,0 +1,91 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// windowsService runs the exporter under the service control manager
+type windowsService struct {
+	a   args
+	run func(args)
+}
+
+// Execute implements svc.Handler, the exporter runs until the service is
+// stopped
+func (s *windowsService) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	go s.run(s.a)
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for r := range requests {
+		switch r.Cmd {
+		case svc.Interrogate:
+			status <- r.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			logrus.Println("Stopping the service")
+			status <- svc.Status{State: svc.StopPending}
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// eventlogHook sends the logs to the windows event log, where the logs of a
+// service are read
+type eventlogHook struct {
+	log *eventlog.Log
+}
+
+// Levels implements logrus.Hook
+func (h *eventlogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (h *eventlogHook) Fire(entry *logrus.Entry) error {
+	message, err := entry.String()
+	if err != nil {
+		return err
+	}
+
+	switch entry.Level {
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		return h.log.Error(1, message)
+	case logrus.WarnLevel:
+		return h.log.Warning(1, message)
+	default:
+		return h.log.Info(1, message)
+	}
+}
+
+// runService runs the exporter as a windows service when the service control
+// manager started it, logging to the event log, and returns whether it did
+func runService(a args, run func(args)) bool {
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil {
+		logrus.Fatalf("could not tell whether running as a windows service: %s", err)
+	}
+	if interactive {
+		return false
+	}
+
+	log, err := eventlog.Open(a.WindowsServiceName)
+	if err != nil {
+		logrus.Warnf("could not open the event log, logging to stderr only: %s", err)
+	} else {
+		defer log.Close()
+		logrus.AddHook(&eventlogHook{log: log})
+	}
+
+	if err := svc.Run(a.WindowsServiceName, &windowsService{a: a, run: run}); err != nil {
+		logrus.Fatal(fmt.Errorf("could not run the %s service: %s", a.WindowsServiceName, err))
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// sink is an output the gathered metrics are periodically pushed to
+type sink interface {
+	fmt.Stringer
+	Push(mfs []*dto.MetricFamily) error
+}
+
+// runSink gathers the metrics every interval and pushes them to the sink
+func runSink(s sink, interval time.Duration, g prometheus.Gatherer) {
+	logrus.Printf("Pushing metrics to %s every %s", s, interval)
+	for range time.Tick(interval) {
+		mfs, err := g.Gather()
+		if err != nil {
+			logrus.Errorf("failed to gather metrics for %s: %s", s, err)
+			if len(mfs) == 0 {
+				continue
+			}
+		}
+
+		start := time.Now()
+		if err := s.Push(mfs); err != nil {
+			logrus.Errorf("failed to push metrics to %s: %s", s, err)
+			continue
+		}
+		logrus.Debugf("Pushed %d metric families to %s in %s", len(mfs), s, time.Since(start))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
+)
+
+// srvDiscovery finds the nomad servers among the targets of a DNS SRV
+// record, and keeps the failover addresses up to date with them
+type srvDiscovery struct {
+	record   string
+	scheme   string
+	interval time.Duration
+}
+
+func newSRVDiscovery(a args) *srvDiscovery {
+	return &srvDiscovery{
+		record:   a.NomadSRVRecord,
+		scheme:   a.NomadSRVScheme,
+		interval: time.Duration(a.NomadSRVRefresh) * time.Second,
+	}
+}
+
+// Start discovers the servers and keeps refreshing them in the background
+func (d *srvDiscovery) Start(t *failoverTransport) error {
+	if err := d.refresh(t); err != nil {
+		return err
+	}
+
+	go func() {
+		for range time.Tick(d.interval) {
+			if err := d.refresh(t); err != nil {
+				collector.LogError(err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *srvDiscovery) refresh(t *failoverTransport) error {
+	addresses, err := d.discover()
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return fmt.Errorf("no targets in SRV record %s", d.record)
+	}
+	logrus.Debugf("Discovered nomad addresses %s", strings.Join(addresses, ", "))
+	return t.set(addresses)
+}
+
+// discover returns the addresses of the targets by priority, the targets of
+// the same priority randomized by weight
+func (d *srvDiscovery) discover() ([]string, error) {
+	_, records, err := net.LookupSRV("", "", d.record)
+	if err != nil {
+		return nil, fmt.Errorf("could not look up SRV record %s: %s", d.record, err)
+	}
+
+	addresses := make([]string, 0, len(records))
+	for _, r := range records {
+		host := strings.TrimSuffix(r.Target, ".")
+		addresses = append(addresses,
+			fmt.Sprintf("%s://%s", d.scheme, net.JoinHostPort(host, strconv.Itoa(int(r.Port)))))
+	}
+	return addresses, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// statsdMaxPacket keeps the datagrams under the usual ethernet MTU
+const statsdMaxPacket = 1432
+
+// statsdSink sends the metrics as DogStatsD datagrams with the labels as
+// tags. Gauges are sent as gauges, and counters as the increment since the
+// previous push.
+type statsdSink struct {
+	address  string
+	conn     net.Conn
+	counters map[string]float64
+}
+
+func newStatsdSink(address string) (*statsdSink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdSink{
+		address:  address,
+		conn:     conn,
+		counters: make(map[string]float64),
+	}, nil
+}
+
+func (s *statsdSink) String() string {
+	return fmt.Sprintf("dogstatsd %s", s.address)
+}
+
+// Push implements sink
+func (s *statsdSink) Push(mfs []*dto.MetricFamily) error {
+	var packet bytes.Buffer
+	send := func(line string) error {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > statsdMaxPacket {
+			if _, err := s.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+		return nil
+	}
+
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.Metric {
+			tags := statsdTags(m.Label)
+
+			var lines []string
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				lines = s.count(name, tags, m.GetCounter().GetValue())
+
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				lines = append(s.count(name+"_count", tags, float64(h.GetSampleCount())),
+					s.count(name+"_sum", tags, h.GetSampleSum())...)
+
+			case dto.MetricType_SUMMARY:
+				sum := m.GetSummary()
+				lines = append(s.count(name+"_count", tags, float64(sum.GetSampleCount())),
+					s.count(name+"_sum", tags, sum.GetSampleSum())...)
+				for _, q := range sum.Quantile {
+					qTags := append(tags, "quantile:"+strconv.FormatFloat(q.GetQuantile(), 'f', -1, 64))
+					lines = append(lines, statsdGauge(name, q.GetValue(), qTags)...)
+				}
+
+			case dto.MetricType_UNTYPED:
+				lines = statsdGauge(name, m.GetUntyped().GetValue(), tags)
+
+			default:
+				lines = statsdGauge(name, m.GetGauge().GetValue(), tags)
+			}
+
+			for _, line := range lines {
+				if err := send(line); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if packet.Len() > 0 {
+		_, err := s.conn.Write(packet.Bytes())
+		return err
+	}
+	return nil
+}
+
+// count returns the increment of a cumulative value since the last push, the
+// first time a series is seen there's nothing to compare with so it's skipped
+func (s *statsdSink) count(name string, tags []string, value float64) []string {
+	key := name + "|" + strings.Join(tags, ",")
+	previous, ok := s.counters[key]
+	s.counters[key] = value
+	if !ok {
+		return nil
+	}
+
+	delta := value - previous
+	if delta < 0 {
+		// the counter was reset
+		delta = value
+	}
+	return []string{statsdLine(name, delta, "c", tags)}
+}
+
+// statsdGauge returns the gauge line, values statsd can't represent are skipped
+func statsdGauge(name string, value float64, tags []string) []string {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil
+	}
+	return []string{statsdLine(name, value, "g", tags)}
+}
+
+func statsdLine(name string, value float64, kind string, tags []string) string {
+	line := name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+func statsdTags(labels []*dto.LabelPair) []string {
+	tags := make([]string, 0, len(labels))
+	for _, l := range labels {
+		tags = append(tags, l.GetName()+":"+statsdTagReplacer.Replace(l.GetValue()))
+	}
+	return tags
+}
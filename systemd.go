@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// systemdFirstFD is the first file descriptor systemd passes the sockets as
+const systemdFirstFD = 3
+
+// systemdSockets are the sockets systemd passed with socket activation, the
+// ones named admin in the socket unit are the admin listener's
+type systemdSockets struct {
+	main  []net.Listener
+	admin []net.Listener
+}
+
+// systemdListeners returns the sockets systemd passed when the exporter is
+// socket activated, none otherwise. The environment is unset so processes
+// the exporter starts don't take them too
+func systemdListeners() (systemdSockets, error) {
+	var sockets systemdSockets
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return sockets, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return sockets, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	for i := 0; i < count; i++ {
+		var name string
+		if i < len(names) {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(systemdFirstFD+i), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return systemdSockets{}, fmt.Errorf("could not use socket %d passed by systemd: %s", systemdFirstFD+i, err)
+		}
+
+		if name == "admin" {
+			sockets.admin = append(sockets.admin, l)
+		} else {
+			sockets.main = append(sockets.main, l)
+		}
+	}
+	return sockets, nil
+}
+
+// sdNotify sends the state to systemd, it does nothing when the exporter
+// isn't started by a notify service
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		return fmt.Errorf("could not connect to systemd notify socket: %s", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("could not notify systemd: %s", err)
+	}
+	return nil
+}
+
+// notifyReady tells systemd the exporter is serving, and pings its watchdog
+// at half the interval the service sets with WatchdogSec
+func notifyReady() {
+	if err := sdNotify("READY=1"); err != nil {
+		logrus.Warn(err)
+	}
+
+	usec, err := strconv.Atoi(os.Getenv("WATCHDOG_USEC"))
+	if err != nil || usec < 1 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+
+	interval := time.Duration(usec) * time.Microsecond / 2
+	logrus.Debugf("Pinging the systemd watchdog every %s", interval)
+	go func() {
+		for range time.Tick(interval) {
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				logrus.Warn(err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/common/expfmt"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// textfileSink writes the metrics in the text exposition format to a file,
+// for node_exporter's textfile collector to pick up. The file is written to
+// a temporary file first and renamed so it's never read half written.
+type textfileSink struct {
+	path string
+}
+
+func (t *textfileSink) String() string {
+	return fmt.Sprintf("textfile %s", t.path)
+}
+
+// Push implements sink
+func (t *textfileSink) Push(mfs []*dto.MetricFamily) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(t.path), "."+filepath.Base(t.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := writeText(tmp, mfs); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), t.path)
+}
+
+// writeText writes the metrics in the text exposition format
+func writeText(w io.Writer, mfs []*dto.MetricFamily) error {
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
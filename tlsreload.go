@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
+)
+
+// tlsReloader loads the CA and client certificate for the connections to
+// nomad, and loads them again when their files change so rotated certs are
+// picked up without a restart. The files are checked on every handshake
+type tlsReloader struct {
+	caFile     string
+	caPath     string
+	certFile   string
+	keyFile    string
+	serverName string
+
+	mu       sync.Mutex
+	modTimes map[string]time.Time
+	pool     *x509.CertPool
+	cert     *tls.Certificate
+}
+
+func newTLSReloader(caFile, caPath, certFile, keyFile, serverName string) (*tlsReloader, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("both the client cert and key must be provided")
+	}
+
+	r := &tlsReloader{
+		caFile:     caFile,
+		caPath:     caPath,
+		certFile:   certFile,
+		keyFile:    keyFile,
+		serverName: serverName,
+		modTimes:   make(map[string]time.Time),
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// configure makes the TLS config of the transport use the reloaded
+// certificates. The server certificate is verified by the reloader, as the
+// root CAs of a TLS config can't be swapped once it's in use, against the
+// server name or else the host dialed: the handshake has no server name for
+// IP addresses
+func (r *tlsReloader) configure(t *http.Transport, insecure bool) {
+	c := t.TLSClientConfig
+	c.ServerName = r.serverName
+	if r.certFile != "" {
+		c.GetClientCertificate = r.clientCertificate
+	}
+	if insecure || (r.caFile == "" && r.caPath == "") {
+		c.InsecureSkipVerify = insecure
+		return
+	}
+	c.InsecureSkipVerify = true
+	// the transport only handshakes itself through proxies
+	c.VerifyConnection = func(cs tls.ConnectionState) error {
+		return r.verifyConnection(cs, cs.ServerName)
+	}
+	t.DialTLSContext = r.dialTLS(t)
+}
+
+// dialTLS dials nomad and verifies its certificate against the server name,
+// or the host dialed when there's none
+func (r *tlsReloader) dialTLS(t *http.Transport) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := t.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		c := t.TLSClientConfig.Clone()
+		if c.ServerName == "" {
+			c.ServerName = host
+		}
+		name := c.ServerName
+		c.VerifyConnection = func(cs tls.ConnectionState) error {
+			return r.verifyConnection(cs, name)
+		}
+
+		if t.TLSHandshakeTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, t.TLSHandshakeTimeout)
+			defer cancel()
+		}
+		tlsConn := tls.Client(conn, c)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+func (r *tlsReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if err := r.reload(); err != nil {
+		collector.LogError(err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, nil
+}
+
+// verifyConnection verifies the certificate of nomad is signed by the CA and
+// valid for the name, there's no connecting without a name to verify
+func (r *tlsReloader) verifyConnection(cs tls.ConnectionState, name string) error {
+	if err := r.reload(); err != nil {
+		collector.LogError(err)
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("nomad sent no certificate")
+	}
+	if name == "" {
+		return fmt.Errorf("no server name to verify the certificate of nomad against, set -tls.tls-server-name")
+	}
+
+	r.mu.Lock()
+	pool := r.pool
+	r.mu.Unlock()
+
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		DNSName:       name,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// reload loads the files again if any of them changed since the last load
+func (r *tlsReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files, err := r.files()
+	if err != nil {
+		return err
+	}
+	modTimes := make(map[string]time.Time, len(files))
+	changed := len(files) != len(r.modTimes)
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return fmt.Errorf("could not stat %s: %s", f, err)
+		}
+		modTimes[f] = info.ModTime()
+		if !info.ModTime().Equal(r.modTimes[f]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" || r.caPath != "" {
+		pool = x509.NewCertPool()
+		for _, f := range files {
+			if f == r.certFile || f == r.keyFile {
+				continue
+			}
+			pem, err := ioutil.ReadFile(f)
+			if err != nil {
+				return fmt.Errorf("could not read CA %s: %s", f, err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no certificates found in CA %s", f)
+			}
+		}
+	}
+
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("could not load client certificate: %s", err)
+		}
+		cert = &c
+	}
+
+	r.pool, r.cert, r.modTimes = pool, cert, modTimes
+	return nil
+}
+
+// files lists the CA files, then the client certificate and key
+func (r *tlsReloader) files() ([]string, error) {
+	var files []string
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	if r.caPath != "" {
+		entries, err := ioutil.ReadDir(r.caPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA path %s: %s", r.caPath, err)
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				files = append(files, filepath.Join(r.caPath, e.Name()))
+			}
+		}
+	}
+	if r.certFile != "" {
+		files = append(files, r.certFile, r.keyFile)
+	}
+	return files, nil
+}
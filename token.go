@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
+)
+
+const tokenFilePollInterval = 5 * time.Second
+
+// tokenTransport injects the current Nomad ACL token into every request, this
+// allows rotating the token without re-creating the api client
+type tokenTransport struct {
+	next  http.RoundTripper
+	token atomic.Value
+}
+
+func withTokenTransport(c *http.Client) *tokenTransport {
+	t := &tokenTransport{next: c.Transport}
+	t.token.Store("")
+	c.Transport = t
+	return t
+}
+
+// SetToken replaces the token used for the following requests
+func (t *tokenTransport) SetToken(token string) {
+	t.token.Store(token)
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *tokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	token := t.token.Load().(string)
+	if token == "" {
+		return t.next.RoundTrip(r)
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set("X-Nomad-Token", token)
+	return t.next.RoundTrip(r)
+}
+
+// watchTokenFile loads the token from the file and reloads it every time the
+// file modification time changes
+func watchTokenFile(path string, tokens *tokenTransport) error {
+	modTime, err := loadTokenFile(path, tokens)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for range time.Tick(tokenFilePollInterval) {
+			info, err := os.Stat(path)
+			if err != nil {
+				collector.LogError(fmt.Errorf("could not stat token file %s: %s", path, err))
+				continue
+			}
+			if info.ModTime().Equal(modTime) {
+				continue
+			}
+
+			m, err := loadTokenFile(path, tokens)
+			if err != nil {
+				collector.LogError(err)
+				continue
+			}
+			modTime = m
+			logrus.Infof("Reloaded nomad token from %s", path)
+		}
+	}()
+	return nil
+}
+
+func loadTokenFile(path string, tokens *tokenTransport) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not stat token file %s: %s", path, err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not read token file %s: %s", path, err)
+	}
+
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return time.Time{}, fmt.Errorf("token file %s is empty", path)
+	}
+	tokens.SetToken(token)
+	return info.ModTime(), nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
+)
+
+const vaultRetryInterval = 10 * time.Second
+
+// vaultTokenRenewer reads the Nomad ACL token from the Vault Nomad secrets
+// engine and keeps its lease renewed, fetching a new one when it can't and
+// revoking the previous one once the new one is in use
+type vaultTokenRenewer struct {
+	address string
+	token   string
+	path    string
+	client  *http.Client
+	tokens  *tokenTransport
+}
+
+type vaultSecret struct {
+	LeaseID       string `json:"lease_id"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+	Data          struct {
+		SecretID string `json:"secret_id"`
+	} `json:"data"`
+}
+
+func newVaultTokenRenewer(address, token, mount, role string, tokens *tokenTransport) *vaultTokenRenewer {
+	return &vaultTokenRenewer{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		path:    fmt.Sprintf("%s/creds/%s", strings.Trim(mount, "/"), role),
+		client:  cleanhttp.DefaultClient(),
+		tokens:  tokens,
+	}
+}
+
+// Start fetches the first token and keeps it fresh in the background
+func (v *vaultTokenRenewer) Start() error {
+	secret, err := v.readCreds()
+	if err != nil {
+		return err
+	}
+	v.tokens.SetToken(secret.Data.SecretID)
+	logrus.Debugf("Fetched nomad token from vault with lease %s", secret.LeaseID)
+
+	go v.run(secret)
+	return nil
+}
+
+func (v *vaultTokenRenewer) run(secret *vaultSecret) {
+	for {
+		if secret.LeaseDuration == 0 {
+			logrus.Debugf("Vault lease %s never expires, stopping renewals", secret.LeaseID)
+			return
+		}
+		time.Sleep(renewAfter(secret.LeaseDuration))
+
+		if secret.Renewable {
+			renewed, err := v.renew(secret)
+			if err == nil && renewed.LeaseDuration >= secret.LeaseDuration/2 {
+				logrus.Debugf("Renewed vault lease %s for %ds", renewed.LeaseID, renewed.LeaseDuration)
+				secret.LeaseDuration = renewed.LeaseDuration
+				continue
+			}
+			if err != nil {
+				collector.LogError(err)
+			}
+		}
+
+		previous := secret
+		for {
+			s, err := v.readCreds()
+			if err == nil {
+				secret = s
+				break
+			}
+			collector.LogError(err)
+			time.Sleep(vaultRetryInterval)
+		}
+		v.tokens.SetToken(secret.Data.SecretID)
+		logrus.Infof("Rotated nomad token from vault with lease %s", secret.LeaseID)
+
+		if err := v.revoke(previous); err != nil {
+			collector.LogError(err)
+		}
+	}
+}
+
+func (v *vaultTokenRenewer) readCreds() (*vaultSecret, error) {
+	secret, err := v.do("GET", "/v1/"+v.path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not read nomad token from vault: %s", err)
+	}
+	if secret.Data.SecretID == "" {
+		return nil, fmt.Errorf("vault path %s returned no secret_id", v.path)
+	}
+	return secret, nil
+}
+
+func (v *vaultTokenRenewer) renew(secret *vaultSecret) (*vaultSecret, error) {
+	renewed, err := v.do("PUT", "/v1/sys/leases/renew", map[string]interface{}{
+		"lease_id":  secret.LeaseID,
+		"increment": secret.LeaseDuration,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not renew vault lease %s: %s", secret.LeaseID, err)
+	}
+	return renewed, nil
+}
+
+// revoke revokes the lease of a token that's no longer used, which deletes
+// the token in nomad instead of leaving it around until the lease expires
+func (v *vaultTokenRenewer) revoke(secret *vaultSecret) error {
+	if secret.LeaseID == "" {
+		return nil
+	}
+	if _, err := v.do("PUT", "/v1/sys/leases/revoke", map[string]interface{}{
+		"lease_id": secret.LeaseID,
+	}); err != nil {
+		return fmt.Errorf("could not revoke vault lease %s: %s", secret.LeaseID, err)
+	}
+	logrus.Debugf("Revoked vault lease %s", secret.LeaseID)
+	return nil
+}
+
+func (v *vaultTokenRenewer) do(method, path string, body interface{}) (*vaultSecret, error) {
+	var b bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&b).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, v.address+path, &b)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return &vaultSecret{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var secret vaultSecret
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// renewAfter returns how long to wait before renewing a lease, leaving a
+// third of the lease as margin
+func renewAfter(leaseSeconds int) time.Duration {
+	d := time.Duration(leaseSeconds) * time.Second * 2 / 3
+	if d < vaultRetryInterval {
+		return vaultRetryInterval
+	}
+	return d
+}
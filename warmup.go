@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
+)
+
+// warmupHandler answers 503 until a collection succeeded, so the mostly empty
+// scrapes of an exporter that just started, or can't collect yet, aren't
+// recorded. The scrapes still collect, and the first one that succeeds is
+// served
+func warmupHandler(e *collector.Exporter, g prometheus.Gatherer) http.Handler {
+	metrics := metricsHandler(g)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if e.Collected() {
+			metrics.ServeHTTP(w, r)
+			return
+		}
+
+		mfs, err := g.Gather()
+		if !e.Collected() {
+			http.Error(w, "the first collection didn't succeed yet", http.StatusServiceUnavailable)
+			return
+		}
+		metricsHandler(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return mfs, err
+		})).ServeHTTP(w, r)
+	})
+}
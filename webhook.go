@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/nomad-exporter/pkg/collector"
+)
+
+// webhookQueue is how many events wait to be posted before new ones are
+// dropped, so a slow endpoint never blocks a collection
+const webhookQueue = 100
+
+// webhookNotifier posts the events the collector notices as json to every
+// endpoint, an event about the same object isn't posted again before the
+// debounce elapsed
+type webhookNotifier struct {
+	urls     []string
+	debounce time.Duration
+	client   *http.Client
+	events   chan collector.Event
+
+	mu   sync.Mutex
+	sent map[string]time.Time
+}
+
+func newWebhookNotifier(urls string, debounce time.Duration) *webhookNotifier {
+	n := &webhookNotifier{
+		debounce: debounce,
+		client:   cleanhttp.DefaultClient(),
+		events:   make(chan collector.Event, webhookQueue),
+		sent:     make(map[string]time.Time),
+	}
+	n.client.Timeout = 10 * time.Second
+	for _, url := range strings.Split(urls, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			n.urls = append(n.urls, url)
+		}
+	}
+	return n
+}
+
+// Notify queues the event unless it's debounced, it's the OnEvent option
+// of the collector
+func (n *webhookNotifier) Notify(event collector.Event) {
+	key := event.Kind + "/" + event.Subject
+
+	n.mu.Lock()
+	for k, t := range n.sent {
+		if event.Time.Sub(t) >= n.debounce {
+			delete(n.sent, k)
+		}
+	}
+	if _, ok := n.sent[key]; ok {
+		n.mu.Unlock()
+		webhookEvents.WithLabelValues(event.Kind, "debounced").Inc()
+		return
+	}
+	n.sent[key] = event.Time
+	n.mu.Unlock()
+
+	select {
+	case n.events <- event:
+	default:
+		logrus.Errorf("webhook queue is full, dropping %s event for %s", event.Kind, event.Subject)
+		webhookEvents.WithLabelValues(event.Kind, "dropped").Inc()
+	}
+}
+
+// run posts the queued events
+func (n *webhookNotifier) run() {
+	for event := range n.events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			logrus.Errorf("could not encode %s event: %s", event.Kind, err)
+			continue
+		}
+		result := "sent"
+		for _, url := range n.urls {
+			if err := n.post(url, body); err != nil {
+				logrus.Errorf("could not post %s event for %s to %s: %s", event.Kind, event.Subject, url, err)
+				result = "failed"
+			}
+		}
+		webhookEvents.WithLabelValues(event.Kind, result).Inc()
+	}
+}
+
+func (n *webhookNotifier) post(url string, body []byte) error {
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}